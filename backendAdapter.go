@@ -0,0 +1,136 @@
+package httpcache
+
+import (
+	"context"
+
+	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
+)
+
+type (
+	// backendAdapter wraps a legacy Backend to fulfill the ContextBackend contract
+	backendAdapter struct {
+		backend Backend
+	}
+
+	// legacyBackend wraps a ContextBackend to fulfill the legacy Backend contract
+	legacyBackend struct {
+		backend ContextBackend
+	}
+)
+
+var (
+	_ ContextBackend       = new(backendAdapter)
+	_ ContextTagSupporting = new(backendAdapter)
+	_ Closing              = new(backendAdapter)
+	_ Backend              = new(legacyBackend)
+	_ TagSupporting        = new(legacyBackend)
+	_ healthcheck.Status   = new(legacyBackend)
+	_ Closing              = new(legacyBackend)
+)
+
+// AdaptBackend wraps a legacy Backend so it can be used where a ContextBackend is required.
+// The context is ignored and Get never reports an error, since the legacy contract can't express one.
+// A Backend wrapped by LegacyBackend is unwrapped, so the context support is not lost.
+func AdaptBackend(backend Backend) ContextBackend {
+	if legacy, ok := backend.(*legacyBackend); ok {
+		return legacy.backend
+	}
+
+	return &backendAdapter{backend: backend}
+}
+
+// Get entry by key
+func (a *backendAdapter) Get(_ context.Context, key string) (Entry, bool, error) {
+	entry, found := a.backend.Get(key)
+
+	return entry, found, nil
+}
+
+// Set entry for key
+func (a *backendAdapter) Set(_ context.Context, key string, entry Entry) error {
+	return a.backend.Set(key, entry) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Purge entry by key
+func (a *backendAdapter) Purge(_ context.Context, key string) error {
+	return a.backend.Purge(key) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Flush the whole cache
+func (a *backendAdapter) Flush(_ context.Context) error {
+	return a.backend.Flush() //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// PurgeTags of the wrapped backend, returns ErrTagsNotSupported if it doesn't implement TagSupporting
+func (a *backendAdapter) PurgeTags(_ context.Context, tags []string) error {
+	tagSupporting, ok := a.backend.(TagSupporting)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	return tagSupporting.PurgeTags(tags) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Close the wrapped backend if it implements Closing
+func (a *backendAdapter) Close() error {
+	return closeBackend(a.backend)
+}
+
+// LegacyBackend wraps a ContextBackend so it can be used where a legacy Backend is required.
+// The background context is used and Get reports a failing backend as miss, AdaptBackend unwraps it again.
+func LegacyBackend(backend ContextBackend) Backend {
+	if adapter, ok := backend.(*backendAdapter); ok {
+		return adapter.backend
+	}
+
+	return &legacyBackend{backend: backend}
+}
+
+// Get entry by key
+func (l *legacyBackend) Get(key string) (Entry, bool) {
+	entry, found, err := l.backend.Get(context.Background(), key)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	return entry, found
+}
+
+// Set entry for key
+func (l *legacyBackend) Set(key string, entry Entry) error {
+	return l.backend.Set(context.Background(), key, entry) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Purge entry by key
+func (l *legacyBackend) Purge(key string) error {
+	return l.backend.Purge(context.Background(), key) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Flush the whole cache
+func (l *legacyBackend) Flush() error {
+	return l.backend.Flush(context.Background()) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// PurgeTags of the wrapped backend, returns ErrTagsNotSupported if it doesn't implement ContextTagSupporting
+func (l *legacyBackend) PurgeTags(tags []string) error {
+	tagSupporting, ok := l.backend.(ContextTagSupporting)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	return tagSupporting.PurgeTags(context.Background(), tags) //nolint:wrapcheck // errors of the wrapped backend are passed through unchanged
+}
+
+// Status of the wrapped backend, it is alive if it doesn't report a status
+func (l *legacyBackend) Status() (bool, string) {
+	if status, ok := l.backend.(healthcheck.Status); ok {
+		return status.Status()
+	}
+
+	return true, ""
+}
+
+// Close the wrapped backend if it implements Closing
+func (l *legacyBackend) Close() error {
+	return closeBackend(l.backend)
+}
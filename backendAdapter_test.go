@@ -0,0 +1,64 @@
+package httpcache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+	"flamingo.me/httpcache/mocks"
+)
+
+func TestLegacyBackend(t *testing.T) {
+	t.Parallel()
+
+	t.Run("wrapped backends keep working with the legacy contract", func(t *testing.T) {
+		t.Parallel()
+
+		contextBackend, err := new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{Size: 10}).Build()
+		require.NoError(t, err)
+
+		backend := httpcache.LegacyBackend(contextBackend)
+		assert.Same(t, contextBackend, httpcache.AdaptBackend(backend), "the context aware backend is unwrapped")
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(backend)
+
+		entry, err := frontend.Get(t.Context(), "key", func(context.Context) (httpcache.Entry, error) {
+			return httpcache.Entry{
+				Meta: httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)},
+				Body: []byte("body"),
+			}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("body"), entry.Body)
+
+		assert.Eventually(t, func() bool {
+			entry, found := backend.Get("key")
+
+			return found && string(entry.Body) == "body"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("failing get is a miss", func(t *testing.T) {
+		t.Parallel()
+
+		contextBackend := mocks.NewContextBackend(t)
+		contextBackend.EXPECT().Get(mock.Anything, "key").Return(httpcache.Entry{}, false, errors.New("broken")).Once()
+
+		_, found := httpcache.LegacyBackend(contextBackend).Get("key")
+		assert.False(t, found)
+	})
+
+	t.Run("adapted backends are unwrapped", func(t *testing.T) {
+		t.Parallel()
+
+		backend := mocks.NewBackend(t)
+		assert.Same(t, backend, httpcache.LegacyBackend(httpcache.AdaptBackend(backend)))
+	})
+}
@@ -1,7 +1,9 @@
 package httpcache_test
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"testing"
 	"time"
 
@@ -20,7 +22,7 @@ type (
 	// BackendTestCase representations
 	BackendTestCase struct {
 		t            *testing.T
-		backend      httpcache.Backend
+		backend      httpcache.ContextBackend
 		tagsInResult bool
 	}
 )
@@ -29,7 +31,7 @@ func init() {
 	gob.Register(new(backendTestEntry))
 }
 
-func NewBackendTestCase(t *testing.T, backend httpcache.Backend, tagsInResult bool) *BackendTestCase {
+func NewBackendTestCase(t *testing.T, backend httpcache.ContextBackend, tagsInResult bool) *BackendTestCase {
 	t.Helper()
 
 	return &BackendTestCase{
@@ -46,10 +48,14 @@ func (tc *BackendTestCase) RunTests() {
 
 	tc.testFlush()
 
-	if _, ok := tc.backend.(httpcache.TagSupporting); ok {
+	if _, ok := tc.backend.(httpcache.ContextTagSupporting); ok {
 		tc.testPurgeTags()
 	}
 
+	if _, ok := tc.backend.(httpcache.ContextMetaUpdating); ok {
+		tc.testUpdateMeta()
+	}
+
 	if _, ok := tc.backend.(healthcheck.Status); ok {
 		tc.testHealthcheck()
 	}
@@ -62,7 +68,7 @@ func (tc *BackendTestCase) testSetGetPurge() {
 	tc.setAndCompareEntry("ONE_KEY", entry, wantedEntry)
 	tc.setAndCompareEntry("ANOTHER_KEY", entry, wantedEntry)
 
-	err := tc.backend.Purge("ONE_KEY")
+	err := tc.backend.Purge(context.Background(), "ONE_KEY")
 	if err != nil {
 		tc.t.Fatalf("Purge Key Failed: %v", err)
 	}
@@ -78,7 +84,7 @@ func (tc *BackendTestCase) testFlush() {
 	tc.setEntry("ONE_KEY", entry)
 	tc.setEntry("ANOTHERKEY_KEY", entry)
 
-	err := tc.backend.Flush()
+	err := tc.backend.Flush(context.Background())
 	if err != nil {
 		tc.t.Fatalf("Flush Failed: %v", err)
 	}
@@ -97,12 +103,12 @@ func (tc *BackendTestCase) testPurgeTags() {
 
 	tagsToPurge := []string{"eins"}
 
-	purge, ok := tc.backend.(httpcache.TagSupporting)
+	purge, ok := tc.backend.(httpcache.ContextTagSupporting)
 	if !ok {
-		tc.t.Fatalf("backend doesnt implement TagSupporting interface")
+		tc.t.Fatalf("backend doesnt implement ContextTagSupporting interface")
 	}
 
-	err := purge.PurgeTags(tagsToPurge)
+	err := purge.PurgeTags(context.Background(), tagsToPurge)
 	if err != nil {
 		tc.t.Fatalf("Purge Tags Failed: %v", err)
 	}
@@ -110,6 +116,52 @@ func (tc *BackendTestCase) testPurgeTags() {
 	tc.shouldNotExist("ONE_KEY")
 	tc.shouldNotExist("ANOTHERKEY_KEY")
 	tc.shouldExist("THIRD_KEY")
+
+	counting, ok := tc.backend.(httpcache.ContextTagCounting)
+	if !ok {
+		return
+	}
+
+	tc.setEntry("FOURTH_KEY", tc.buildEntry("ASDF", []string{"drei"}))
+	tc.setEntry("FIFTH_KEY", tc.buildEntry("ASDF", []string{"drei", "vier"}))
+
+	purged, err := counting.PurgeTagsWithCount(context.Background(), []string{"drei", "vier"})
+	if err != nil {
+		tc.t.Fatalf("Purge Tags With Count Failed: %v", err)
+	}
+
+	if purged != 2 {
+		tc.t.Fatalf("Purge Tags With Count purged %d entries, expected 2", purged)
+	}
+
+	tc.shouldNotExist("FOURTH_KEY")
+	tc.shouldNotExist("FIFTH_KEY")
+}
+
+func (tc *BackendTestCase) testUpdateMeta() {
+	updating, ok := tc.backend.(httpcache.ContextMetaUpdating)
+	if !ok {
+		tc.t.Fatalf("backend doesnt implement ContextMetaUpdating interface")
+	}
+
+	entry := tc.buildEntry("stored body", []string{"eins"})
+	tc.setEntry("REVALIDATED_KEY", entry)
+
+	revalidated := tc.buildEntry("stored body", []string{"eins"})
+	revalidated.Meta.LifeTime = time.Now().Add(time.Hour)
+	revalidated.Meta.GraceTime = time.Now().Add(2 * time.Hour)
+
+	err := updating.UpdateMeta(context.Background(), "REVALIDATED_KEY", revalidated)
+	if err != nil {
+		tc.t.Fatalf("UpdateMeta Failed: %v", err)
+	}
+
+	tc.getAndCompareEntry("REVALIDATED_KEY", revalidated)
+
+	err = updating.UpdateMeta(context.Background(), "MISSING_KEY", revalidated)
+	if err != nil && !errors.Is(err, httpcache.ErrEntryNotFound) {
+		tc.t.Fatalf("UpdateMeta of missing key Failed: %v", err)
+	}
 }
 
 func (tc *BackendTestCase) testHealthcheck() {
@@ -124,7 +176,7 @@ func (tc *BackendTestCase) testHealthcheck() {
 }
 
 func (tc *BackendTestCase) setEntry(key string, entry httpcache.Entry) {
-	err := tc.backend.Set(key, entry)
+	err := tc.backend.Set(context.Background(), key, entry)
 	if err != nil {
 		tc.t.Fatalf("Failed to set Entry for key %v with error: %v", key, err)
 	}
@@ -152,7 +204,9 @@ func (tc *BackendTestCase) mustBeEqual(entry httpcache.Entry, wanted httpcache.E
 }
 
 func (tc *BackendTestCase) shouldExist(key string) httpcache.Entry {
-	entry, found := tc.backend.Get(key)
+	entry, found, err := tc.backend.Get(context.Background(), key)
+	require.NoError(tc.t, err)
+
 	if !found {
 		tc.t.Fatalf("Failed to get Entry with key: %v", key)
 	}
@@ -161,7 +215,9 @@ func (tc *BackendTestCase) shouldExist(key string) httpcache.Entry {
 }
 
 func (tc *BackendTestCase) shouldNotExist(key string) {
-	entry, found := tc.backend.Get(key)
+	entry, found, err := tc.backend.Get(context.Background(), key)
+	require.NoError(tc.t, err)
+
 	if found {
 		tc.t.Fatalf("Entry with key %v should not exists, but returns %v", key, entry)
 	}
@@ -2,11 +2,15 @@ package httpcache
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
 type (
 	// Backend to persist cache data
+	//
+	// Backend is the legacy contract without context support which can not report errors on Get.
+	// New backends should implement ContextBackend, existing implementations can be adapted with AdaptBackend.
 	Backend interface {
 		Get(key string) (Entry, bool)
 		Set(key string, entry Entry) error
@@ -14,11 +18,51 @@ type (
 		Flush() error
 	}
 
+	// ContextBackend to persist cache data, respecting the deadline of the given context.
+	// Get returns found=false and a nil error on a cache miss, errors are reserved for a failing backend.
+	ContextBackend interface {
+		Get(ctx context.Context, key string) (Entry, bool, error)
+		Set(ctx context.Context, key string, entry Entry) error
+		Purge(ctx context.Context, key string) error
+		Flush(ctx context.Context) error
+	}
+
 	// TagSupporting describes a cache backend, responsible for storing, flushing, setting and getting entries
+	//
+	// TagSupporting is the legacy contract for backends implementing Backend, see ContextTagSupporting.
 	TagSupporting interface {
 		PurgeTags(tags []string) error
 	}
 
+	// ContextTagSupporting describes a ContextBackend able to purge all entries carrying one of the given tags
+	ContextTagSupporting interface {
+		PurgeTags(ctx context.Context, tags []string) error
+	}
+
+	// ContextTagCounting describes a ContextTagSupporting backend able to report the number of entries purged by tags
+	ContextTagCounting interface {
+		PurgeTagsWithCount(ctx context.Context, tags []string) (int, error)
+	}
+
+	// ContextMetaUpdating describes a ContextBackend able to replace everything but the body of a stored entry,
+	// so revalidated entries are not written again. UpdateMeta returns ErrEntryNotFound if the key is not stored.
+	ContextMetaUpdating interface {
+		UpdateMeta(ctx context.Context, key string, entry Entry) error
+	}
+
+	// ContextVariantIndexing describes a ContextBackend keeping the variant keys of a key itself, so concurrent updates
+	// e.g. of several instances sharing the backend never drop each other's variants. Both methods return
+	// ErrVariantIndexNotSupported if the backend can't keep them, e.g. a two level backend without supporting level.
+	ContextVariantIndexing interface {
+		// AddVariant adds the variant key to the variants of the key atomically, they are kept at least until keepUntil
+		AddVariant(ctx context.Context, key string, variant string, keepUntil time.Time) error
+		// RemoveVariants removes all variants of the key atomically and returns them, so they can be purged
+		RemoveVariants(ctx context.Context, key string) ([]string, error)
+	}
+
+	// Closing describes a backend holding resources like connections or background tasks, which are released by Close
+	Closing = io.Closer
+
 	// Entry represents a cached HTTP Response
 	Entry struct {
 		Meta       Meta
@@ -26,15 +70,51 @@ type (
 		Status     string
 		StatusCode int
 		Body       []byte
+		// BodyEncoding is the content coding of a Body returned compressed by a backend, see WithAcceptEncoding
+		BodyEncoding string
 	}
 
 	// Meta data for a cache Entry
 	Meta struct {
 		LifeTime  time.Time
 		GraceTime time.Time
+		// StaleTime is the point in time until the entry may still be served if the loader fails, see Frontend.SetStaleIfError
+		StaleTime time.Time
 		Tags      []string
+		// CreatedAt is the point in time the entry was loaded, set by the Frontend if the loader leaves it empty
+		CreatedAt time.Time
+		// LoadDuration is the time the loader took to create the entry
+		LoadDuration time.Duration
+		// Variants are the keys of the stored variants if the entry is the variant index of a response with a Vary header
+		Variants []string
+		// NoStore marks a loaded entry which is only returned to the caller of the loader, the Frontend neither stores it
+		// nor passes it to coalesced callers, e.g. a response with Cache-Control no-store or private
+		NoStore bool
+		// Revalidated marks a loaded entry with StatusCode http.StatusNotModified, which revalidated the PreviousEntry
+		// of the loader context with its validators. Other not modified entries are returned to the caller only.
+		Revalidated bool
 	}
 
-	// HTTPLoader returns an Entry to be cached. All Entries will be cached if error is nil
+	// HTTPLoader returns an Entry to be cached. All Entries will be cached if error is nil, unless Meta.NoStore is set.
+	// A loader revalidating the PreviousEntry of its context returns an Entry with StatusCode http.StatusNotModified,
+	// Meta.Revalidated set and the new Meta, see Frontend.Get.
 	HTTPLoader func(context.Context) (Entry, error)
 )
+
+// KeepUntil returns the point in time until a backend has to keep the entry, which is the later one of GraceTime and StaleTime
+func (m Meta) KeepUntil() time.Time {
+	if m.StaleTime.After(m.GraceTime) {
+		return m.StaleTime
+	}
+
+	return m.GraceTime
+}
+
+// closeBackend closes the backend if it implements Closing
+func closeBackend(backend any) error {
+	if closing, ok := backend.(Closing); ok {
+		return closing.Close() //nolint:wrapcheck // errors of the backend are passed through unchanged
+	}
+
+	return nil
+}
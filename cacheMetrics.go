@@ -17,6 +17,15 @@ var (
 	backendCacheMissCount         = stats.Int64("flamingo/httpcache/backend/miss", "Count of cache-backend misses", stats.UnitDimensionless)
 	backendCacheErrorCount        = stats.Int64("flamingo/httpcache/backend/error", "Count of cache-backend errors", stats.UnitDimensionless)
 	backendCacheEntriesCount      = stats.Int64("flamingo/httpcache/backend/entries", "Count of cache-backend entries", stats.UnitDimensionless)
+	frontendRefreshQueuedCount    = stats.Int64("flamingo/httpcache/frontend/refresh/queued", "Count of queued background refreshes", stats.UnitDimensionless)
+	frontendRefreshDroppedCount   = stats.Int64("flamingo/httpcache/frontend/refresh/dropped", "Count of dropped background refreshes", stats.UnitDimensionless)
+	frontendRefreshQueueLength    = stats.Int64("flamingo/httpcache/frontend/refresh/queue", "Length of the background refresh queue", stats.UnitDimensionless)
+	frontendNegativeHitCount      = stats.Int64("flamingo/httpcache/frontend/negative/hit", "Count of negative cache hits", stats.UnitDimensionless)
+	frontendUncacheableCount      = stats.Int64("flamingo/httpcache/frontend/uncacheable", "Count of loaded entries not stored by the cacheability policy", stats.UnitDimensionless)
+	backendCompressionRatio       = stats.Float64("flamingo/httpcache/backend/compression/ratio", "Ratio of compressed to uncompressed body size", stats.UnitDimensionless)
+	backendTagSetsCount           = stats.Int64("flamingo/httpcache/backend/tags/sets", "Count of tag sets", stats.UnitDimensionless)
+	backendTagSetSize             = stats.Int64("flamingo/httpcache/backend/tags/size", "Count of keys in a tag set", stats.UnitDimensionless)
+	backendTagCompactedCount      = stats.Int64("flamingo/httpcache/backend/tags/compacted", "Count of keys of expired entries removed from tag sets", stats.UnitDimensionless)
 )
 
 type (
@@ -44,6 +53,13 @@ func NewCacheMetrics(backendType string, frontendName string) Metrics {
 	return b
 }
 
+// newFrontendMetrics creates a metrics helper instance for frontend metrics, which are not related to a backend type
+func newFrontendMetrics(frontendName string) Metrics {
+	return Metrics{
+		frontendName: frontendName,
+	}
+}
+
 func init() {
 	if err := opencensus.View(
 		"flamingo/httpcache/backend/hit",
@@ -85,6 +101,91 @@ func init() {
 	); err != nil {
 		panic(err)
 	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/frontend/refresh/queued",
+		frontendRefreshQueuedCount,
+		view.Count(),
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/frontend/refresh/dropped",
+		frontendRefreshDroppedCount,
+		view.Count(),
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/frontend/refresh/queue",
+		frontendRefreshQueueLength,
+		view.LastValue(),
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/frontend/negative/hit",
+		frontendNegativeHitCount,
+		view.Count(),
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/frontend/uncacheable",
+		frontendUncacheableCount,
+		view.Count(),
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/backend/compression/ratio",
+		backendCompressionRatio,
+		view.Distribution(0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1),
+		backendTypeCacheKeyType,
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/backend/tags/sets",
+		backendTagSetsCount,
+		view.LastValue(),
+		backendTypeCacheKeyType,
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/backend/tags/size",
+		backendTagSetSize,
+		view.Distribution(1, 10, 100, 1000, 10000, 100000),
+		backendTypeCacheKeyType,
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
+
+	if err := opencensus.View(
+		"flamingo/httpcache/backend/tags/compacted",
+		backendTagCompactedCount,
+		view.Sum(),
+		backendTypeCacheKeyType,
+		frontendNameCacheKeyType,
+	); err != nil {
+		panic(err)
+	}
 }
 
 func (bi Metrics) countHit() {
@@ -127,3 +228,66 @@ func (bi Metrics) recordEntries(entries int64) {
 	)
 	stats.Record(ctx, backendCacheEntriesCount.M(entries))
 }
+
+func (bi Metrics) recordCompressionRatio(ratio float64) {
+	ctx, _ := tag.New(
+		context.Background(),
+		tag.Upsert(opencensus.KeyArea, "cacheBackend"),
+		tag.Upsert(backendTypeCacheKeyType, bi.backendType),
+		tag.Upsert(frontendNameCacheKeyType, bi.frontendName),
+	)
+	stats.Record(ctx, backendCompressionRatio.M(ratio))
+}
+
+func (bi Metrics) backendContext() context.Context {
+	ctx, _ := tag.New(
+		context.Background(),
+		tag.Upsert(opencensus.KeyArea, "cacheBackend"),
+		tag.Upsert(backendTypeCacheKeyType, bi.backendType),
+		tag.Upsert(frontendNameCacheKeyType, bi.frontendName),
+	)
+
+	return ctx
+}
+
+func (bi Metrics) recordTagSets(sets int64) {
+	stats.Record(bi.backendContext(), backendTagSetsCount.M(sets))
+}
+
+func (bi Metrics) recordTagSetSize(size int64) {
+	stats.Record(bi.backendContext(), backendTagSetSize.M(size))
+}
+
+func (bi Metrics) countTagsCompacted(count int64) {
+	stats.Record(bi.backendContext(), backendTagCompactedCount.M(count))
+}
+
+func (bi Metrics) frontendContext() context.Context {
+	ctx, _ := tag.New(
+		context.Background(),
+		tag.Upsert(opencensus.KeyArea, "cacheFrontend"),
+		tag.Upsert(frontendNameCacheKeyType, bi.frontendName),
+	)
+
+	return ctx
+}
+
+func (bi Metrics) countRefreshQueued() {
+	stats.Record(bi.frontendContext(), frontendRefreshQueuedCount.M(1))
+}
+
+func (bi Metrics) countRefreshDropped() {
+	stats.Record(bi.frontendContext(), frontendRefreshDroppedCount.M(1))
+}
+
+func (bi Metrics) recordRefreshQueueLength(length int64) {
+	stats.Record(bi.frontendContext(), frontendRefreshQueueLength.M(length))
+}
+
+func (bi Metrics) countNegativeHit() {
+	stats.Record(bi.frontendContext(), frontendNegativeHitCount.M(1))
+}
+
+func (bi Metrics) countUncacheable() {
+	stats.Record(bi.frontendContext(), frontendUncacheableCount.M(1))
+}
@@ -0,0 +1,183 @@
+package httpcache
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCacheStatusName identifies frontends without a name in the Cache-Status header
+const defaultCacheStatusName = "httpcache"
+
+// CacheStatus describes how the Frontend served an entry
+type CacheStatus string
+
+const (
+	// CacheStatusHit is a fresh entry served from the backend
+	CacheStatusHit CacheStatus = "HIT"
+	// CacheStatusStale is an entry served in its grace time while it is refreshed in background
+	CacheStatusStale CacheStatus = "STALE"
+	// CacheStatusMiss is an entry loaded by the loader of the caller
+	CacheStatusMiss CacheStatus = "MISS"
+	// CacheStatusCoalesced is an entry loaded by the loader of a concurrent caller
+	CacheStatusCoalesced CacheStatus = "COALESCED"
+	// CacheStatusErrorStale is an expired entry served because the loader failed, see Frontend.SetStaleIfError
+	CacheStatusErrorStale CacheStatus = "ERROR_STALE"
+)
+
+type (
+	// CacheInfo describes how the Frontend served an entry
+	CacheInfo struct {
+		Status CacheStatus
+		// Frontend is the name of the Frontend, see Frontend.SetName
+		Frontend string
+		// Age of the entry since it was loaded, 0 for entries without Meta.CreatedAt
+		Age time.Duration
+		// TTL is the remaining lifetime of the entry, negative for stale entries
+		TTL time.Duration
+		// Stored is set if a loaded entry was stored, see Frontend.SetCacheabilityPolicy
+		Stored bool
+		// Backend which served the entry, e.g. "memory" or "redis", empty for loaded entries and unknown backends.
+		// The TwoLevelBackend prefixes the backend with the level which served the entry, e.g. "second:redis".
+		Backend string
+	}
+
+	servingBackendKey struct{}
+)
+
+// ReportServingBackend is called by backends on a hit, so the Frontend can report which backend served the entry
+func ReportServingBackend(ctx context.Context, backend string) {
+	if serving, ok := ctx.Value(servingBackendKey{}).(*string); ok {
+		*serving = backend
+	}
+}
+
+// servingBackend returns the backend reported so far
+func servingBackend(ctx context.Context) string {
+	if serving, ok := ctx.Value(servingBackendKey{}).(*string); ok {
+		return *serving
+	}
+
+	return ""
+}
+
+// withServingBackend returns a context collecting the backend reported by ReportServingBackend
+func withServingBackend(ctx context.Context) (context.Context, *string) {
+	serving := new(string)
+
+	return context.WithValue(ctx, servingBackendKey{}, serving), serving
+}
+
+func (f *Frontend) cacheInfo(status CacheStatus, entry Entry, backend string) CacheInfo {
+	info := CacheInfo{Status: status, Frontend: f.name, Backend: backend}
+
+	if !entry.Meta.CreatedAt.IsZero() {
+		info.Age = max(time.Since(entry.Meta.CreatedAt), 0)
+	}
+
+	if !entry.Meta.LifeTime.IsZero() {
+		info.TTL = time.Until(entry.Meta.LifeTime)
+	}
+
+	return info
+}
+
+// CacheStatusHeader returns the value of the Cache-Status header describing the info, see RFC 9211.
+// Entries served from the backend are a hit, loaded ones were forwarded and stored, e.g.
+//
+//	myServiceCache; hit; ttl=42; detail=memory
+//	myServiceCache; fwd=uri-miss; stored; collapsed; ttl=300
+//
+// Stale entries served because the loader failed were forwarded, the detail names the failure:
+//
+//	myServiceCache; fwd=stale; ttl=-60; detail=loader-error
+func (i CacheInfo) CacheStatusHeader() string {
+	name := i.Frontend
+	if name == "" {
+		name = defaultCacheStatusName
+	}
+
+	params := []string{structuredItem(name)}
+
+	switch i.Status {
+	case CacheStatusHit, CacheStatusStale:
+		params = append(params, "hit")
+	case CacheStatusErrorStale:
+		// the stale entry is no hit, it was served because forwarding the request failed
+		params = append(params, "fwd=stale")
+	case CacheStatusMiss, CacheStatusCoalesced:
+		params = append(params, "fwd=uri-miss")
+	}
+
+	if i.Stored {
+		params = append(params, "stored")
+	}
+
+	if i.Status == CacheStatusCoalesced {
+		params = append(params, "collapsed")
+	}
+
+	// ttl is rounded down, so an entry which just became stale does not claim a ttl of 0
+	params = append(params, "ttl="+strconv.FormatFloat(math.Floor(i.TTL.Seconds()), 'f', 0, 64))
+
+	switch {
+	case i.Status == CacheStatusErrorStale:
+		params = append(params, "detail=loader-error")
+	case i.Backend != "":
+		params = append(params, "detail="+structuredItem(i.Backend))
+	}
+
+	return strings.Join(params, "; ")
+}
+
+// addCacheStatusHeader appends the cache to the Cache-Status header, caches closer to the client are listed last
+func addCacheStatusHeader(header http.Header, info CacheInfo) {
+	header.Add("Cache-Status", info.CacheStatusHeader())
+}
+
+// structuredItem returns the value as token if possible or as quoted string, see RFC 8941
+func structuredItem(value string) string {
+	if isStructuredToken(value) {
+		return value
+	}
+
+	return strconv.Quote(strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+
+		return r
+	}, value))
+}
+
+func isStructuredToken(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	first := value[0]
+	if first != '*' && !('a' <= first && first <= 'z' || 'A' <= first && first <= 'Z') {
+		return false
+	}
+
+	for _, char := range []byte(value[1:]) {
+		if !isTokenChar(char) && char != ':' && char != '/' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isTokenChar reports whether the char is a tchar, see RFC 9110 section 5.6.2
+func isTokenChar(char byte) bool {
+	switch {
+	case 'a' <= char && char <= 'z', 'A' <= char && char <= 'Z', '0' <= char && char <= '9':
+		return true
+	}
+
+	return strings.IndexByte("!#$%&'*+-.^_`|~", char) >= 0
+}
@@ -0,0 +1,69 @@
+package httpcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"flamingo.me/httpcache"
+)
+
+func TestCacheInfo_CacheStatusHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		info httpcache.CacheInfo
+		want string
+	}{
+		{
+			name: "hit",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusHit, Frontend: "api", TTL: 42500 * time.Millisecond, Backend: "second:redis"},
+			want: "api; hit; ttl=42; detail=second:redis",
+		},
+		{
+			name: "stale",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusStale, Frontend: "api", TTL: -500 * time.Millisecond, Backend: "memory"},
+			want: "api; hit; ttl=-1; detail=memory",
+		},
+		{
+			name: "error stale",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusErrorStale, Frontend: "api", TTL: -time.Minute, Backend: "memory"},
+			want: "api; fwd=stale; ttl=-60; detail=loader-error",
+		},
+		{
+			name: "miss",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusMiss, Frontend: "api", TTL: time.Minute, Stored: true},
+			want: "api; fwd=uri-miss; stored; ttl=60",
+		},
+		{
+			name: "coalesced",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusCoalesced, Frontend: "api", TTL: time.Minute, Stored: true},
+			want: "api; fwd=uri-miss; stored; collapsed; ttl=60",
+		},
+		{
+			name: "not stored",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusMiss, Frontend: "api"},
+			want: "api; fwd=uri-miss; ttl=0",
+		},
+		{
+			name: "unnamed frontend",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusMiss, Stored: true},
+			want: "httpcache; fwd=uri-miss; stored; ttl=0",
+		},
+		{
+			name: "names which are no token are quoted",
+			info: httpcache.CacheInfo{Status: httpcache.CacheStatusHit, Frontend: `my "api" cache`},
+			want: `"my \"api\" cache"; hit; ttl=0`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.info.CacheStatusHeader())
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package httpcache
+
+import (
+	"net/http"
+	"slices"
+)
+
+type (
+	// CacheabilityPolicy decides whether a loaded entry is stored, entries which are not stored are still returned to the caller
+	CacheabilityPolicy interface {
+		IsCacheable(entry Entry) bool
+	}
+
+	// DefaultCacheabilityPolicy stores entries depending on their status code, body size and headers.
+	// Entries with a Cache-Control header containing no-store or private are never stored.
+	DefaultCacheabilityPolicy struct {
+		// StatusCodes of entries which are stored, defaults to the status codes cacheable by default (see RFC 9111).
+		// Entries without a status code are stored regardless.
+		StatusCodes []int
+		// MaxBodySize in bytes of entries which are stored, 0 for no limit
+		MaxBodySize int
+		// ForbiddenHeaders prevent storing an entry if it has one of them, e.g. Set-Cookie
+		ForbiddenHeaders []string
+	}
+)
+
+var _ CacheabilityPolicy = DefaultCacheabilityPolicy{}
+
+// IsCacheable if the entry has an allowed status code, does not exceed the max body size and has no forbidden header
+func (p DefaultCacheabilityPolicy) IsCacheable(entry Entry) bool {
+	if entry.StatusCode != 0 && !p.isAllowedStatus(entry.StatusCode) {
+		return false
+	}
+
+	if p.MaxBodySize > 0 && len(entry.Body) > p.MaxBodySize {
+		return false
+	}
+
+	header := http.Header(entry.Header)
+
+	for _, name := range p.ForbiddenHeaders {
+		if len(header.Values(name)) > 0 {
+			return false
+		}
+	}
+
+	return !parseCacheControl(header.Values("Cache-Control")).notStorable()
+}
+
+func (p DefaultCacheabilityPolicy) isAllowedStatus(statusCode int) bool {
+	if len(p.StatusCodes) == 0 {
+		return isCacheableStatus(statusCode)
+	}
+
+	return slices.Contains(p.StatusCodes, statusCode)
+}
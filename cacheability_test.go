@@ -0,0 +1,85 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flamingo.me/httpcache"
+)
+
+func TestDefaultCacheabilityPolicy_IsCacheable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		policy httpcache.DefaultCacheabilityPolicy
+		entry  httpcache.Entry
+		want   bool
+	}{
+		{
+			name:  "cacheable status by default",
+			entry: httpcache.Entry{StatusCode: http.StatusNotFound},
+			want:  true,
+		},
+		{
+			name:  "server error by default",
+			entry: httpcache.Entry{StatusCode: http.StatusInternalServerError},
+			want:  false,
+		},
+		{
+			name:  "entry without status code",
+			entry: httpcache.Entry{Body: []byte("data")},
+			want:  true,
+		},
+		{
+			name:   "status code not allowed",
+			policy: httpcache.DefaultCacheabilityPolicy{StatusCodes: []int{http.StatusOK}},
+			entry:  httpcache.Entry{StatusCode: http.StatusNotFound},
+			want:   false,
+		},
+		{
+			name:   "status code allowed",
+			policy: httpcache.DefaultCacheabilityPolicy{StatusCodes: []int{http.StatusOK, http.StatusServiceUnavailable}},
+			entry:  httpcache.Entry{StatusCode: http.StatusServiceUnavailable},
+			want:   true,
+		},
+		{
+			name:   "body too large",
+			policy: httpcache.DefaultCacheabilityPolicy{MaxBodySize: 3},
+			entry:  httpcache.Entry{StatusCode: http.StatusOK, Body: []byte("data")},
+			want:   false,
+		},
+		{
+			name:   "body within limit",
+			policy: httpcache.DefaultCacheabilityPolicy{MaxBodySize: 4},
+			entry:  httpcache.Entry{StatusCode: http.StatusOK, Body: []byte("data")},
+			want:   true,
+		},
+		{
+			name:   "forbidden header",
+			policy: httpcache.DefaultCacheabilityPolicy{ForbiddenHeaders: []string{"set-cookie"}},
+			entry:  httpcache.Entry{StatusCode: http.StatusOK, Header: map[string][]string{"Set-Cookie": {"session=1"}}},
+			want:   false,
+		},
+		{
+			name:  "no-store",
+			entry: httpcache.Entry{StatusCode: http.StatusOK, Header: map[string][]string{"Cache-Control": {"no-store"}}},
+			want:  false,
+		},
+		{
+			name:  "private",
+			entry: httpcache.Entry{StatusCode: http.StatusOK, Header: map[string][]string{"Cache-Control": {"private, max-age=60"}}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.policy.IsCacheable(tt.entry))
+		})
+	}
+}
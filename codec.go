@@ -0,0 +1,177 @@
+package httpcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// CodecGob selects the GobCodec in RedisBackendConfig
+	CodecGob = "gob"
+	// CodecBinary selects the BinaryCodec in RedisBackendConfig
+	CodecBinary = "binary"
+	// CodecJSON selects the JSONCodec in RedisBackendConfig
+	CodecJSON = "json"
+	// CodecMsgpack selects the MsgpackCodec in RedisBackendConfig
+	CodecMsgpack = "msgpack"
+
+	// Format bytes of the shipped codecs. Formats are chosen from 0x80 to 0xf7, which never start a gob stream,
+	// so entries stored as plain gob before codecs were introduced are still recognized.
+	formatGob      byte = 0x80
+	formatBinaryV1 byte = 0x81
+	formatJSON     byte = 0x82
+	formatMsgpack  byte = 0x83
+
+	minCodecFormat byte = 0x80
+	maxCodecFormat byte = 0xf7
+)
+
+var (
+	ErrUnknownCodec       = errors.New("unknown codec")
+	ErrInvalidCodecFormat = errors.New("codec format must be between 0x80 and 0xf7")
+
+	// errUndecodableEntry marks stored entries of an unknown format, e.g. written by a newer release, which are treated as miss
+	errUndecodableEntry = errors.New("undecodable entry")
+)
+
+type (
+	// Codec encodes the entries stored by the RedisBackend. The body of an entry is stored separately and
+	// not passed to the codec. The backend stores the Format in front of every encoded entry, so entries are
+	// decoded by the codec which encoded them, even if the configured codec changed meanwhile.
+	Codec interface {
+		// Format identifies the codec and the version of its encoding, it must be between 0x80 and 0xf7
+		Format() byte
+		Encode(entry Entry) ([]byte, error)
+		Decode(data []byte) (Entry, error)
+	}
+
+	// GobCodec encodes entries with encoding/gob, the encoding used before codecs were configurable
+	GobCodec struct{}
+
+	// JSONCodec encodes entries as JSON, which is readable when debugging the stored entries
+	JSONCodec struct{}
+)
+
+var (
+	_ Codec = GobCodec{}
+	_ Codec = JSONCodec{}
+	_ Codec = BinaryCodec{}
+	_ Codec = MsgpackCodec{}
+)
+
+// NewCodec returns the shipped codec with the given name, an empty name selects the GobCodec
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case "", CodecGob:
+		return GobCodec{}, nil
+	case CodecBinary:
+		return BinaryCodec{}, nil
+	case CodecJSON:
+		return JSONCodec{}, nil
+	case CodecMsgpack:
+		return MsgpackCodec{}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+}
+
+// Format of the gob encoding
+func (GobCodec) Format() byte {
+	return formatGob
+}
+
+// Encode the entry with encoding/gob
+func (GobCodec) Encode(entry Entry) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	err := gob.NewEncoder(buffer).Encode(entry)
+	if err != nil {
+		return nil, fmt.Errorf("gob encode failed: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decode the entry with encoding/gob
+func (GobCodec) Decode(data []byte) (Entry, error) {
+	var entry Entry
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("gob decode failed: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Format of the JSON encoding
+func (JSONCodec) Format() byte {
+	return formatJSON
+}
+
+// Encode the entry as JSON
+func (JSONCodec) Encode(entry Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("json encode failed: %w", err)
+	}
+
+	return data, nil
+}
+
+// Decode the entry from JSON
+func (JSONCodec) Decode(data []byte) (Entry, error) {
+	var entry Entry
+
+	err := json.Unmarshal(data, &entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("json decode failed: %w", err)
+	}
+
+	return entry, nil
+}
+
+// validateCodec checks the format of a codec, so it can not be mistaken for a legacy gob entry
+func validateCodec(codec Codec) error {
+	if format := codec.Format(); format < minCodecFormat || format > maxCodecFormat {
+		return fmt.Errorf("%w: %#x", ErrInvalidCodecFormat, format)
+	}
+
+	return nil
+}
+
+// encodeWithFormat prefixes the encoded entry with the format of the codec
+func encodeWithFormat(codec Codec, entry Entry) ([]byte, error) {
+	data, err := codec.Encode(entry)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the codec describes the error
+	}
+
+	return append([]byte{codec.Format()}, data...), nil
+}
+
+// decodeWithFormat decodes the entry with the codec of its format. Entries without format are decoded as gob,
+// entries of unknown formats or legacy entries which can not be decoded anymore return errUndecodableEntry.
+func decodeWithFormat(codecs map[byte]Codec, data []byte) (Entry, error) {
+	if len(data) == 0 {
+		return Entry{}, fmt.Errorf("empty entry: %w", errUndecodableEntry)
+	}
+
+	if codec, found := codecs[data[0]]; found {
+		return codec.Decode(data[1:]) //nolint:wrapcheck // the codec describes the error
+	}
+
+	if data[0] >= minCodecFormat && data[0] <= maxCodecFormat {
+		return Entry{}, fmt.Errorf("format %#x: %w", data[0], errUndecodableEntry)
+	}
+
+	entry, err := GobCodec{}.Decode(data)
+	if err != nil {
+		return Entry{}, fmt.Errorf("legacy gob entry: %w: %w", errUndecodableEntry, err)
+	}
+
+	return entry, nil
+}
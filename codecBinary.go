@@ -0,0 +1,183 @@
+package httpcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errTruncatedEntry = errors.New("truncated entry")
+
+type (
+	// BinaryCodec encodes entries in a compact binary format, which is faster and smaller than gob.
+	// Changes of the format get a new Format byte, so entries of older releases are still decoded.
+	BinaryCodec struct{}
+
+	// binaryReader reads the fields of an entry, the first error stops all further reads
+	binaryReader struct {
+		data []byte
+		err  error
+	}
+)
+
+// Format of the first version of the binary encoding
+func (BinaryCodec) Format() byte {
+	return formatBinaryV1
+}
+
+// Encode the meta data, header and status of the entry
+func (BinaryCodec) Encode(entry Entry) ([]byte, error) {
+	data := make([]byte, 0, 256)
+
+	data = appendTime(data, entry.Meta.LifeTime)
+	data = appendTime(data, entry.Meta.GraceTime)
+	data = appendTime(data, entry.Meta.StaleTime)
+	data = appendTime(data, entry.Meta.CreatedAt)
+	data = binary.AppendVarint(data, int64(entry.Meta.LoadDuration))
+	data = appendStrings(data, entry.Meta.Tags)
+	data = appendStrings(data, entry.Meta.Variants)
+
+	data = binary.AppendUvarint(data, uint64(len(entry.Header)))
+	for name, values := range entry.Header {
+		data = appendString(data, name)
+		data = appendStrings(data, values)
+	}
+
+	data = appendString(data, entry.Status)
+	data = binary.AppendVarint(data, int64(entry.StatusCode))
+
+	return data, nil
+}
+
+// Decode an entry encoded by Encode
+func (BinaryCodec) Decode(data []byte) (Entry, error) {
+	reader := &binaryReader{data: data}
+
+	var entry Entry
+
+	entry.Meta.LifeTime = reader.time()
+	entry.Meta.GraceTime = reader.time()
+	entry.Meta.StaleTime = reader.time()
+	entry.Meta.CreatedAt = reader.time()
+	entry.Meta.LoadDuration = time.Duration(reader.varint())
+	entry.Meta.Tags = reader.strings()
+	entry.Meta.Variants = reader.strings()
+
+	if count := reader.length(); count > 0 {
+		entry.Header = make(map[string][]string, count)
+
+		for range count {
+			name := reader.string()
+			entry.Header[name] = reader.strings()
+		}
+	}
+
+	entry.Status = reader.string()
+	entry.StatusCode = int(reader.varint())
+
+	if reader.err == nil && len(reader.data) > 0 {
+		reader.err = fmt.Errorf("%d bytes left", len(reader.data))
+	}
+
+	if reader.err != nil {
+		return Entry{}, fmt.Errorf("binary decode failed: %w", reader.err)
+	}
+
+	return entry, nil
+}
+
+// appendTime as unix nano seconds, the zero time is stored as 0
+func appendTime(data []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return binary.AppendVarint(data, 0)
+	}
+
+	return binary.AppendVarint(data, t.UnixNano())
+}
+
+func appendString(data []byte, value string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(value)))
+
+	return append(data, value...)
+}
+
+// appendStrings stores nil and empty slices alike
+func appendStrings(data []byte, values []string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(values)))
+	for _, value := range values {
+		data = appendString(data, value)
+	}
+
+	return data
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errTruncatedEntry
+
+		return 0
+	}
+
+	r.data = r.data[n:]
+
+	return value
+}
+
+// length of a string or slice, which can not be longer than the remaining data
+func (r *binaryReader) length() int {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 || value > uint64(len(r.data)-n) {
+		r.err = errTruncatedEntry
+
+		return 0
+	}
+
+	r.data = r.data[n:]
+
+	return int(value)
+}
+
+func (r *binaryReader) time() time.Time {
+	nanos := r.varint()
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+func (r *binaryReader) string() string {
+	length := r.length()
+	if r.err != nil {
+		return ""
+	}
+
+	value := string(r.data[:length])
+	r.data = r.data[length:]
+
+	return value
+}
+
+func (r *binaryReader) strings() []string {
+	count := r.length()
+	if count == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, count)
+	for range count {
+		values = append(values, r.string())
+	}
+
+	return values
+}
@@ -0,0 +1,494 @@
+package httpcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// msgpack type bytes, see https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	msgpackNil        byte = 0xc0
+	msgpackFalse      byte = 0xc2
+	msgpackTrue       byte = 0xc3
+	msgpackBin8       byte = 0xc4
+	msgpackBin32      byte = 0xc6
+	msgpackExt8       byte = 0xc7
+	msgpackExt32      byte = 0xc9
+	msgpackFloat32    byte = 0xca
+	msgpackFloat64    byte = 0xcb
+	msgpackFixExt1    byte = 0xd4
+	msgpackFixExt4    byte = 0xd6
+	msgpackFixExt8    byte = 0xd7
+	msgpackFixExt16   byte = 0xd8
+	msgpackUint8      byte = 0xcc
+	msgpackUint16     byte = 0xcd
+	msgpackUint32     byte = 0xce
+	msgpackUint64     byte = 0xcf
+	msgpackInt8       byte = 0xd0
+	msgpackInt16      byte = 0xd1
+	msgpackInt32      byte = 0xd2
+	msgpackInt64      byte = 0xd3
+	msgpackStr8       byte = 0xd9
+	msgpackStr16      byte = 0xda
+	msgpackStr32      byte = 0xdb
+	msgpackArray16    byte = 0xdc
+	msgpackArray32    byte = 0xdd
+	msgpackMap16      byte = 0xde
+	msgpackMap32      byte = 0xdf
+	msgpackTimestamp  byte = 0xff // extension type -1
+	msgpackFixMap     byte = 0x80
+	msgpackFixArray   byte = 0x90
+	msgpackFixStr     byte = 0xa0
+	msgpackNegFixInt  byte = 0xe0
+	msgpackFixMaxSize      = 15
+)
+
+var errUnexpectedMsgpackType = errors.New("unexpected msgpack type")
+
+type (
+	// MsgpackCodec encodes entries as MessagePack map, so they can be read by other languages as well.
+	// Times are encoded with the MessagePack timestamp extension, zero times as nil.
+	// Unknown fields, e.g. added by newer releases or other writers, are skipped when decoding.
+	MsgpackCodec struct{}
+
+	// msgpackReader reads the subset of MessagePack written by the MsgpackCodec, the first error stops all further reads
+	msgpackReader struct {
+		data []byte
+		err  error
+	}
+)
+
+// Format of the MessagePack encoding
+func (MsgpackCodec) Format() byte {
+	return formatMsgpack
+}
+
+// Encode the entry as MessagePack map
+func (MsgpackCodec) Encode(entry Entry) ([]byte, error) {
+	data := make([]byte, 0, 256)
+
+	data = appendMsgpackMapHeader(data, 4)
+
+	data = appendMsgpackString(data, "meta")
+	data = appendMsgpackMapHeader(data, 7)
+	data = appendMsgpackString(data, "lifeTime")
+	data = appendMsgpackTime(data, entry.Meta.LifeTime)
+	data = appendMsgpackString(data, "graceTime")
+	data = appendMsgpackTime(data, entry.Meta.GraceTime)
+	data = appendMsgpackString(data, "staleTime")
+	data = appendMsgpackTime(data, entry.Meta.StaleTime)
+	data = appendMsgpackString(data, "createdAt")
+	data = appendMsgpackTime(data, entry.Meta.CreatedAt)
+	data = appendMsgpackString(data, "loadDuration")
+	data = appendMsgpackInt(data, int64(entry.Meta.LoadDuration))
+	data = appendMsgpackString(data, "tags")
+	data = appendMsgpackStrings(data, entry.Meta.Tags)
+	data = appendMsgpackString(data, "variants")
+	data = appendMsgpackStrings(data, entry.Meta.Variants)
+
+	data = appendMsgpackString(data, "header")
+	data = appendMsgpackMapHeader(data, len(entry.Header))
+
+	for name, values := range entry.Header {
+		data = appendMsgpackString(data, name)
+		data = appendMsgpackStrings(data, values)
+	}
+
+	data = appendMsgpackString(data, "status")
+	data = appendMsgpackString(data, entry.Status)
+	data = appendMsgpackString(data, "statusCode")
+	data = appendMsgpackInt(data, int64(entry.StatusCode))
+
+	return data, nil
+}
+
+// Decode an entry encoded by Encode
+func (MsgpackCodec) Decode(data []byte) (Entry, error) {
+	reader := &msgpackReader{data: data}
+
+	var entry Entry
+
+	for range reader.mapLength() {
+		switch field := reader.string(); field {
+		case "meta":
+			reader.meta(&entry.Meta)
+		case "header":
+			entry.Header = reader.header()
+		case "status":
+			entry.Status = reader.string()
+		case "statusCode":
+			entry.StatusCode = int(reader.int())
+		default:
+			reader.skip()
+		}
+	}
+
+	if reader.err == nil && len(reader.data) > 0 {
+		reader.err = fmt.Errorf("%d bytes left", len(reader.data))
+	}
+
+	if reader.err != nil {
+		return Entry{}, fmt.Errorf("msgpack decode failed: %w", reader.err)
+	}
+
+	return entry, nil
+}
+
+func appendMsgpackMapHeader(data []byte, length int) []byte {
+	switch {
+	case length <= msgpackFixMaxSize:
+		return append(data, msgpackFixMap|byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, msgpackMap16), uint16(length))
+	}
+
+	return binary.BigEndian.AppendUint32(append(data, msgpackMap32), uint32(length)) //nolint:gosec // maps of entries are far smaller
+}
+
+func appendMsgpackArrayHeader(data []byte, length int) []byte {
+	switch {
+	case length <= msgpackFixMaxSize:
+		return append(data, msgpackFixArray|byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, msgpackArray16), uint16(length))
+	}
+
+	return binary.BigEndian.AppendUint32(append(data, msgpackArray32), uint32(length)) //nolint:gosec // slices of entries are far smaller
+}
+
+func appendMsgpackString(data []byte, value string) []byte {
+	length := len(value)
+
+	switch {
+	case length < 32:
+		data = append(data, msgpackFixStr|byte(length))
+	case length <= math.MaxUint8:
+		data = append(data, msgpackStr8, byte(length))
+	case length <= math.MaxUint16:
+		data = binary.BigEndian.AppendUint16(append(data, msgpackStr16), uint16(length))
+	default:
+		data = binary.BigEndian.AppendUint32(append(data, msgpackStr32), uint32(length)) //nolint:gosec // strings of entries are far smaller
+	}
+
+	return append(data, value...)
+}
+
+func appendMsgpackStrings(data []byte, values []string) []byte {
+	if values == nil {
+		return append(data, msgpackNil)
+	}
+
+	data = appendMsgpackArrayHeader(data, len(values))
+	for _, value := range values {
+		data = appendMsgpackString(data, value)
+	}
+
+	return data
+}
+
+func appendMsgpackInt(data []byte, value int64) []byte {
+	if value >= 0 && value < int64(msgpackFixMap) {
+		return append(data, byte(value))
+	}
+
+	return binary.BigEndian.AppendUint64(append(data, msgpackInt64), uint64(value)) //nolint:gosec // two's complement is intended
+}
+
+// appendMsgpackTime as timestamp 96 extension, the zero time as nil
+func appendMsgpackTime(data []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(data, msgpackNil)
+	}
+
+	data = append(data, msgpackExt8, 12, msgpackTimestamp)
+	data = binary.BigEndian.AppendUint32(data, uint32(t.Nanosecond())) //nolint:gosec // nano seconds are below one second
+
+	return binary.BigEndian.AppendUint64(data, uint64(t.Unix())) //nolint:gosec // two's complement is intended
+}
+
+func (r *msgpackReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *msgpackReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(r.data) {
+		r.fail(errTruncatedEntry)
+
+		return nil
+	}
+
+	value := r.data[:n]
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *msgpackReader) typeByte() byte {
+	if value := r.next(1); value != nil {
+		return value[0]
+	}
+
+	return 0
+}
+
+// peekNil consumes a nil value
+func (r *msgpackReader) peekNil() bool {
+	if r.err == nil && len(r.data) > 0 && r.data[0] == msgpackNil {
+		r.data = r.data[1:]
+
+		return true
+	}
+
+	return false
+}
+
+func (r *msgpackReader) uint(size int) uint64 {
+	value := r.next(size)
+	if value == nil {
+		return 0
+	}
+
+	var result uint64
+	for _, b := range value {
+		result = result<<8 | uint64(b)
+	}
+
+	return result
+}
+
+func (r *msgpackReader) length(fix, fixMask, length16, length32 byte) int {
+	typ := r.typeByte()
+
+	var length uint64
+
+	switch {
+	case r.err != nil:
+		return 0
+	case typ&^fixMask == fix:
+		length = uint64(typ & fixMask)
+	case typ == length16:
+		length = r.uint(2)
+	case typ == length32:
+		length = r.uint(4)
+	default:
+		r.fail(fmt.Errorf("%w %#x", errUnexpectedMsgpackType, typ))
+
+		return 0
+	}
+
+	// every element takes at least one byte
+	if length > uint64(len(r.data)) {
+		r.fail(errTruncatedEntry)
+
+		return 0
+	}
+
+	return int(length)
+}
+
+func (r *msgpackReader) mapLength() int {
+	return r.length(msgpackFixMap, 0x0f, msgpackMap16, msgpackMap32)
+}
+
+func (r *msgpackReader) arrayLength() int {
+	return r.length(msgpackFixArray, 0x0f, msgpackArray16, msgpackArray32)
+}
+
+func (r *msgpackReader) string() string {
+	typ := r.typeByte()
+
+	var length uint64
+
+	switch {
+	case r.err != nil:
+		return ""
+	case typ&^0x1f == msgpackFixStr:
+		length = uint64(typ & 0x1f)
+	case typ == msgpackStr8:
+		length = r.uint(1)
+	case typ == msgpackStr16:
+		length = r.uint(2)
+	case typ == msgpackStr32:
+		length = r.uint(4)
+	default:
+		r.fail(fmt.Errorf("%w %#x, expected string", errUnexpectedMsgpackType, typ))
+
+		return ""
+	}
+
+	if length > uint64(len(r.data)) {
+		r.fail(errTruncatedEntry)
+
+		return ""
+	}
+
+	return string(r.next(int(length)))
+}
+
+func (r *msgpackReader) strings() []string {
+	if r.peekNil() {
+		return nil
+	}
+
+	count := r.arrayLength()
+
+	values := make([]string, 0, count)
+	for range count {
+		values = append(values, r.string())
+	}
+
+	return values
+}
+
+func (r *msgpackReader) int() int64 {
+	typ := r.typeByte()
+
+	switch {
+	case r.err != nil:
+		return 0
+	case typ < msgpackFixMap:
+		return int64(typ)
+	case typ >= msgpackNegFixInt:
+		return int64(int8(typ)) //nolint:gosec // negative fix ints are two's complement
+	case typ >= msgpackUint8 && typ <= msgpackUint64:
+		return int64(r.uint(1 << (typ - msgpackUint8))) //nolint:gosec // values of entries fit into int64
+	case typ >= msgpackInt8 && typ <= msgpackInt64:
+		size := 1 << (typ - msgpackInt8)
+		shift := 64 - 8*size
+
+		return int64(r.uint(size)<<shift) >> shift //nolint:gosec // sign extension of two's complement
+	}
+
+	r.fail(fmt.Errorf("%w %#x", errUnexpectedMsgpackType, typ))
+
+	return 0
+}
+
+// time reads all timestamp extension formats and nil as zero time
+func (r *msgpackReader) time() time.Time {
+	if r.peekNil() {
+		return time.Time{}
+	}
+
+	typ := r.typeByte()
+
+	switch {
+	case r.err != nil:
+		return time.Time{}
+	case typ == msgpackFixExt4 && r.typeByte() == msgpackTimestamp:
+		return time.Unix(int64(r.uint(4)), 0)
+	case typ == msgpackFixExt8 && r.typeByte() == msgpackTimestamp:
+		value := r.uint(8)
+
+		return time.Unix(int64(value&0x3ffffffff), int64(value>>34)) //nolint:gosec // 34 bit seconds and 30 bit nano seconds
+	case typ == msgpackExt8 && r.typeByte() == 12 && r.typeByte() == msgpackTimestamp:
+		nanos := r.uint(4)
+
+		return time.Unix(int64(r.uint(8)), int64(nanos)) //nolint:gosec // two's complement is intended
+	}
+
+	r.fail(fmt.Errorf("%w %#x, expected timestamp", errUnexpectedMsgpackType, typ))
+
+	return time.Time{}
+}
+
+// skip reads a value of any type, e.g. of an unknown field
+func (r *msgpackReader) skip() {
+	if r.err == nil && len(r.data) == 0 {
+		r.fail(errTruncatedEntry)
+	}
+
+	if r.err != nil {
+		return
+	}
+
+	switch typ := r.data[0]; {
+	case typ&^0x0f == msgpackFixMap, typ == msgpackMap16, typ == msgpackMap32:
+		for range 2 * r.mapLength() {
+			r.skip()
+		}
+	case typ&^0x0f == msgpackFixArray, typ == msgpackArray16, typ == msgpackArray32:
+		for range r.arrayLength() {
+			r.skip()
+		}
+	case typ&^0x1f == msgpackFixStr, typ >= msgpackStr8 && typ <= msgpackStr32:
+		r.string()
+	default:
+		r.skipScalar(r.typeByte())
+	}
+}
+
+// skipScalar reads the data following the type byte of a value which is neither map, array nor string
+func (r *msgpackReader) skipScalar(typ byte) {
+	switch {
+	case typ < msgpackFixMap, typ >= msgpackNegFixInt, typ == msgpackNil, typ == msgpackFalse, typ == msgpackTrue:
+	case typ >= msgpackBin8 && typ <= msgpackBin32:
+		r.next(int(r.uint(1 << (typ - msgpackBin8)))) //nolint:gosec // lengths beyond the data fail in next
+	case typ >= msgpackExt8 && typ <= msgpackExt32:
+		r.next(1 + int(r.uint(1<<(typ-msgpackExt8)))) //nolint:gosec // lengths beyond the data fail in next
+	case typ == msgpackFloat32:
+		r.next(4)
+	case typ == msgpackFloat64:
+		r.next(8)
+	case typ >= msgpackUint8 && typ <= msgpackUint64:
+		r.next(1 << (typ - msgpackUint8))
+	case typ >= msgpackInt8 && typ <= msgpackInt64:
+		r.next(1 << (typ - msgpackInt8))
+	case typ >= msgpackFixExt1 && typ <= msgpackFixExt16:
+		r.next(1 + 1<<(typ-msgpackFixExt1))
+	default:
+		r.fail(fmt.Errorf("%w %#x", errUnexpectedMsgpackType, typ))
+	}
+}
+
+func (r *msgpackReader) meta(meta *Meta) {
+	for range r.mapLength() {
+		switch field := r.string(); field {
+		case "lifeTime":
+			meta.LifeTime = r.time()
+		case "graceTime":
+			meta.GraceTime = r.time()
+		case "staleTime":
+			meta.StaleTime = r.time()
+		case "createdAt":
+			meta.CreatedAt = r.time()
+		case "loadDuration":
+			meta.LoadDuration = time.Duration(r.int())
+		case "tags":
+			meta.Tags = r.strings()
+		case "variants":
+			meta.Variants = r.strings()
+		default:
+			r.skip()
+		}
+	}
+}
+
+func (r *msgpackReader) header() map[string][]string {
+	if r.peekNil() {
+		return nil
+	}
+
+	count := r.mapLength()
+	if count == 0 {
+		return nil
+	}
+
+	header := make(map[string][]string, count)
+
+	for range count {
+		name := r.string()
+		header[name] = r.strings()
+	}
+
+	return header
+}
@@ -0,0 +1,105 @@
+package httpcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestCodecs(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	entry := httpcache.Entry{
+		Meta: httpcache.Meta{
+			LifeTime:     now.Add(time.Minute),
+			GraceTime:    now.Add(2 * time.Minute),
+			StaleTime:    now.Add(-time.Hour),
+			CreatedAt:    now,
+			LoadDuration: 42 * time.Millisecond,
+			Tags:         []string{"tag-a", "tag-b"},
+			Variants:     []string{"key|vary|Accept-Language=de"},
+		},
+		Header: map[string][]string{
+			"Content-Type": {"text/plain"},
+			"X-Long":       {string(make([]byte, 300))},
+			"X-Multiple":   {"1", "2"},
+		},
+		Status:     "404 Not Found",
+		StatusCode: 404,
+	}
+
+	for _, name := range []string{httpcache.CodecGob, httpcache.CodecBinary, httpcache.CodecJSON, httpcache.CodecMsgpack} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			codec, err := httpcache.NewCodec(name)
+			require.NoError(t, err)
+
+			data, err := codec.Encode(entry)
+			require.NoError(t, err)
+
+			decoded, err := codec.Decode(data)
+			require.NoError(t, err)
+
+			assert.True(t, entry.Meta.LifeTime.Equal(decoded.Meta.LifeTime))
+			assert.True(t, entry.Meta.GraceTime.Equal(decoded.Meta.GraceTime))
+			assert.True(t, entry.Meta.StaleTime.Equal(decoded.Meta.StaleTime))
+			assert.True(t, entry.Meta.CreatedAt.Equal(decoded.Meta.CreatedAt))
+			assert.Equal(t, entry.Meta.LoadDuration, decoded.Meta.LoadDuration)
+			assert.Equal(t, entry.Meta.Tags, decoded.Meta.Tags)
+			assert.Equal(t, entry.Meta.Variants, decoded.Meta.Variants)
+			assert.Equal(t, entry.Header, decoded.Header)
+			assert.Equal(t, entry.Status, decoded.Status)
+			assert.Equal(t, entry.StatusCode, decoded.StatusCode)
+
+			empty, err := codec.Encode(httpcache.Entry{})
+			require.NoError(t, err)
+
+			decoded, err = codec.Decode(empty)
+			require.NoError(t, err)
+			assert.True(t, decoded.Meta.LifeTime.IsZero())
+			assert.Empty(t, decoded.Header)
+
+			_, err = codec.Decode(data[:len(data)/2])
+			assert.Error(t, err, "truncated data")
+		})
+	}
+
+	t.Run("msgpack skips unknown fields", func(t *testing.T) {
+		t.Parallel()
+
+		codec := httpcache.MsgpackCodec{}
+
+		data, err := codec.Encode(entry)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x84, 0xa4, 'm', 'e', 't', 'a', 0x87}, data[:7], "fix maps of entry and meta")
+
+		// the meta map gets the field "x": 256, the entry map the field "extra": {"a": [1, -1, nil, true, 1.5, bin 0x0102], "b": timestamp}
+		extended := append([]byte{0x85, 0xa4, 'm', 'e', 't', 'a', 0x88, 0xa1, 'x', 0xcd, 0x01, 0x00}, data[7:]...)
+		extended = append(extended, 0xa5, 'e', 'x', 't', 'r', 'a', 0x82,
+			0xa1, 'a', 0x96, 0x01, 0xff, 0xc0, 0xc3, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, 0xc4, 0x02, 0x01, 0x02,
+			0xa1, 'b', 0xd6, 0xff, 0, 0, 0, 1)
+
+		decoded, err := codec.Decode(extended)
+		require.NoError(t, err)
+		assert.True(t, entry.Meta.LifeTime.Equal(decoded.Meta.LifeTime))
+		assert.Equal(t, entry.Meta.Tags, decoded.Meta.Tags)
+		assert.Equal(t, entry.Header, decoded.Header)
+		assert.Equal(t, entry.StatusCode, decoded.StatusCode)
+
+		_, err = codec.Decode(extended[:len(extended)-2])
+		assert.Error(t, err, "truncated unknown field")
+	})
+
+	t.Run("unknown codec", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := httpcache.NewCodec("xml")
+		assert.ErrorIs(t, err, httpcache.ErrUnknownCodec)
+	})
+}
@@ -0,0 +1,276 @@
+package httpcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionGzip compresses bodies with gzip
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses bodies with zstd
+	CompressionZstd = "zstd"
+)
+
+var (
+	ErrUnknownCompression = errors.New("unknown compression algorithm")
+
+	// zstdDecoder is shared by all backends, since bodies stay readable if the configured algorithm changes
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil)
+	})
+)
+
+type (
+	// CompressionConfig of the body compression of a backend. The algorithm names are the content codings
+	// of the compressed bodies, so they can be served as they are to clients accepting them, see WithAcceptEncoding.
+	CompressionConfig struct {
+		// Algorithm is either "gzip" or "zstd"
+		Algorithm string
+		// MinSize in bytes, smaller bodies are stored uncompressed
+		MinSize int
+		// Level of the algorithm, 0 selects its default level
+		Level int
+	}
+
+	// bodyCompressor compresses the bodies of the entries stored by a backend, a nil bodyCompressor stores them as they are
+	bodyCompressor struct {
+		encoding string
+		minSize  int
+		compress func(body []byte) ([]byte, error)
+		metrics  Metrics
+	}
+
+	acceptEncodingKey struct{}
+)
+
+// WithAcceptEncoding returns a context announcing the content codings accepted by the client, using the syntax of the
+// Accept-Encoding header. Backends return compressed bodies in the accepted codings as they are and set
+// Entry.BodyEncoding, all other bodies are decompressed.
+func WithAcceptEncoding(ctx context.Context, acceptEncoding string) context.Context {
+	return context.WithValue(ctx, acceptEncodingKey{}, acceptEncoding)
+}
+
+func acceptEncodingFromContext(ctx context.Context) string {
+	acceptEncoding, _ := ctx.Value(acceptEncodingKey{}).(string)
+
+	return acceptEncoding
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value accepts the content coding, see RFC 9110 section 12.5.3
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	wildcard := false
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case encoding:
+			return qualityValue(params) > 0
+		case "*":
+			wildcard = qualityValue(params) > 0
+		}
+	}
+
+	return wildcard
+}
+
+// qualityValue of the parameters of an Accept-Encoding element, invalid values are treated as not acceptable
+func qualityValue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(name, "q") {
+			continue
+		}
+
+		quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0
+		}
+
+		return quality
+	}
+
+	return 1
+}
+
+// newBodyCompressor for the config, a nil config disables the compression
+func newBodyCompressor(config *CompressionConfig, metrics Metrics) (*bodyCompressor, error) {
+	if config == nil {
+		return nil, nil //nolint:nilnil // no compressor is a valid result
+	}
+
+	compressor := &bodyCompressor{
+		encoding: config.Algorithm,
+		minSize:  config.MinSize,
+		metrics:  metrics,
+	}
+
+	switch config.Algorithm {
+	case CompressionGzip:
+		level := config.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, fmt.Errorf("gzip level %d: %w", config.Level, err)
+		}
+
+		compressor.compress = func(body []byte) ([]byte, error) {
+			return gzipCompress(body, level)
+		}
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if config.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(config.Level)
+		}
+
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, fmt.Errorf("zstd level %d: %w", config.Level, err)
+		}
+
+		compressor.compress = func(body []byte) ([]byte, error) {
+			return encoder.EncodeAll(body, nil), nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, config.Algorithm)
+	}
+
+	return compressor, nil
+}
+
+// compressEntry returns the entry with a compressed body. Small bodies, bodies with a Content-Encoding and bodies
+// which do not get smaller are returned as they are, as well as bodies compressed already.
+func (c *bodyCompressor) compressEntry(entry Entry) (Entry, error) {
+	if c == nil || entry.BodyEncoding != "" || len(entry.Body) == 0 || len(entry.Body) < c.minSize {
+		return entry, nil
+	}
+
+	if http.Header(entry.Header).Get("Content-Encoding") != "" {
+		return entry, nil
+	}
+
+	compressed, err := c.compress(entry.Body)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s compression failed: %w", c.encoding, err)
+	}
+
+	c.metrics.recordCompressionRatio(float64(len(compressed)) / float64(len(entry.Body)))
+
+	if len(compressed) >= len(entry.Body) {
+		return entry, nil
+	}
+
+	entry.Body = compressed
+	entry.BodyEncoding = c.encoding
+
+	return entry, nil
+}
+
+// entryForContext returns the entry with a body in a content coding accepted by the context, see WithAcceptEncoding
+func entryForContext(ctx context.Context, entry Entry) (Entry, error) {
+	if entry.BodyEncoding == "" || acceptsEncoding(acceptEncodingFromContext(ctx), entry.BodyEncoding) {
+		return entry, nil
+	}
+
+	return decompressEntry(entry)
+}
+
+// decompressEntry returns the entry with the uncompressed body
+func decompressEntry(entry Entry) (Entry, error) {
+	var (
+		body []byte
+		err  error
+	)
+
+	switch entry.BodyEncoding {
+	case "":
+		return entry, nil
+	case CompressionGzip:
+		body, err = gzipDecompress(entry.Body)
+	case CompressionZstd:
+		var decoder *zstd.Decoder
+
+		decoder, err = zstdDecoder()
+		if err == nil {
+			body, err = decoder.DecodeAll(entry.Body, nil)
+		}
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownCompression, entry.BodyEncoding)
+	}
+
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s decompression failed: %w", entry.BodyEncoding, err)
+	}
+
+	entry.Body = body
+	entry.BodyEncoding = ""
+
+	return entry, nil
+}
+
+func gzipCompress(body []byte, level int) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	writer, err := gzip.NewWriterLevel(buffer, level)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by compressEntry
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by compressEntry
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by compressEntry
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func gzipDecompress(body []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by decompressEntry
+	}
+
+	defer reader.Close()
+
+	return io.ReadAll(reader) //nolint:wrapcheck // wrapped by decompressEntry
+}
+
+// setBodyEncoding announces the content coding of a compressed body in the header of the response serving it
+func setBodyEncoding(header http.Header, entry Entry) {
+	if entry.BodyEncoding == "" {
+		return
+	}
+
+	header.Set("Content-Encoding", entry.BodyEncoding)
+	// the stored length is the one of the uncompressed body
+	header.Del("Content-Length")
+
+	for _, value := range header.Values("Vary") {
+		if slices.ContainsFunc(strings.Split(value, ","), func(name string) bool {
+			name = strings.TrimSpace(name)
+
+			return name == "*" || strings.EqualFold(name, "Accept-Encoding")
+		}) {
+			return
+		}
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+}
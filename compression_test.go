@@ -0,0 +1,96 @@
+package httpcache_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestMemoryBackend_Compression(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("compressible body ", 100)
+
+	newEntry := func(body string) httpcache.Entry {
+		return httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Hour), GraceTime: time.Now().Add(time.Hour)},
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+			StatusCode: 200,
+			Body:       []byte(body),
+		}
+	}
+
+	for _, algorithm := range []string{httpcache.CompressionGzip, httpcache.CompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			t.Parallel()
+
+			backend, err := new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{
+				Size:        10,
+				Compression: &httpcache.CompressionConfig{Algorithm: algorithm, MinSize: 100, Level: 3},
+			}).Build()
+			require.NoError(t, err)
+
+			require.NoError(t, backend.Set(t.Context(), "large", newEntry(body)))
+			require.NoError(t, backend.Set(t.Context(), "small", newEntry("small body")))
+
+			entry, found, err := backend.Get(t.Context(), "large")
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, body, string(entry.Body), "bodies are decompressed for clients not accepting the encoding")
+			assert.Empty(t, entry.BodyEncoding)
+
+			entry, found, err = backend.Get(httpcache.WithAcceptEncoding(t.Context(), "deflate, "+algorithm), "large")
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, algorithm, entry.BodyEncoding)
+			assert.Less(t, len(entry.Body), len(body))
+
+			entry, found, err = backend.Get(httpcache.WithAcceptEncoding(t.Context(), "*"), "small")
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Empty(t, entry.BodyEncoding, "bodies below the minimum size are not compressed")
+			assert.Equal(t, "small body", string(entry.Body))
+		})
+	}
+
+	t.Run("bodies with a content encoding are not compressed", func(t *testing.T) {
+		t.Parallel()
+
+		backend, err := new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{
+			Size:        10,
+			Compression: &httpcache.CompressionConfig{Algorithm: httpcache.CompressionGzip},
+		}).Build()
+		require.NoError(t, err)
+
+		entry := newEntry(body)
+		entry.Header["Content-Encoding"] = []string{"br"}
+		require.NoError(t, backend.Set(t.Context(), "encoded", entry))
+
+		entry, found, err := backend.Get(httpcache.WithAcceptEncoding(t.Context(), "gzip"), "encoded")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Empty(t, entry.BodyEncoding)
+		assert.Equal(t, body, string(entry.Body))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{
+			Size:        10,
+			Compression: &httpcache.CompressionConfig{Algorithm: "br"},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrUnknownCompression)
+
+		_, err = new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{
+			Size:        10,
+			Compression: &httpcache.CompressionConfig{Algorithm: httpcache.CompressionGzip, Level: 12},
+		}).Build()
+		assert.Error(t, err)
+	})
+}
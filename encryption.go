@@ -0,0 +1,132 @@
+package httpcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// formatEncrypted starts every encrypted value, it is neither a codec format nor the start of a gob stream
+	formatEncrypted byte = 0xf8
+
+	keyIDSize = 4
+)
+
+var (
+	ErrInvalidEncryptionKey = errors.New("encryption keys must be base64 encoded with a length of 16, 24 or 32 bytes")
+
+	// errDecryptionFailed marks stored values which are not encrypted or can not be decrypted with the configured keys
+	errDecryptionFailed = errors.New("decryption failed")
+)
+
+type (
+	// EncryptionConfig of the AES-GCM encryption of the entries stored by the RedisBackend. Keys are base64 encoded
+	// and have a length of 16, 24 or 32 bytes, selecting AES-128, AES-192 or AES-256.
+	EncryptionConfig struct {
+		// Key encrypting the stored entries, it decrypts them as well
+		Key string
+		// DecryptKeys are former keys, so entries stored before a key rotation are still decrypted
+		DecryptKeys []string
+	}
+
+	// entryCipher encrypts stored values, a nil entryCipher stores them as they are
+	entryCipher struct {
+		keyID uint32
+		aeads map[uint32]cipher.AEAD
+	}
+)
+
+// newEntryCipher for the config, a nil config disables the encryption
+func newEntryCipher(config *EncryptionConfig) (*entryCipher, error) {
+	if config == nil {
+		return nil, nil //nolint:nilnil // no cipher is a valid result
+	}
+
+	c := &entryCipher{aeads: make(map[uint32]cipher.AEAD, len(config.DecryptKeys)+1)}
+
+	for i, encoded := range append([]string{config.Key}, config.DecryptKeys...) {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+		}
+
+		// the key id identifies the key without revealing it, so values are decrypted by the key which encrypted them
+		hash := sha256.Sum256(key)
+		keyID := binary.BigEndian.Uint32(hash[:keyIDSize])
+
+		if i == 0 {
+			c.keyID = keyID
+		}
+
+		c.aeads[keyID] = aead
+	}
+
+	return c, nil
+}
+
+// seal the value as format byte, key id, nonce and cipher text. The additional data binds the value to the
+// place it is stored, so encrypted values can not be swapped between keys.
+func (c *entryCipher) seal(value []byte, additionalData string) ([]byte, error) {
+	if c == nil {
+		return value, nil
+	}
+
+	aead := c.aeads[c.keyID]
+
+	sealed := make([]byte, 1+keyIDSize+aead.NonceSize(), 1+keyIDSize+aead.NonceSize()+len(value)+aead.Overhead())
+	sealed[0] = formatEncrypted
+	binary.BigEndian.PutUint32(sealed[1:], c.keyID)
+
+	nonce := sealed[1+keyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce generation failed: %w", err)
+	}
+
+	return aead.Seal(sealed, nonce, value, []byte(additionalData)), nil
+}
+
+// open a value sealed with one of the configured keys, values which are not encrypted are rejected
+func (c *entryCipher) open(sealed []byte, additionalData string) ([]byte, error) {
+	if c == nil {
+		return sealed, nil
+	}
+
+	if len(sealed) < 1+keyIDSize || sealed[0] != formatEncrypted {
+		return nil, fmt.Errorf("%w: value is not encrypted", errDecryptionFailed)
+	}
+
+	keyID := binary.BigEndian.Uint32(sealed[1:])
+
+	aead, found := c.aeads[keyID]
+	if !found {
+		return nil, fmt.Errorf("%w: unknown key id %#08x", errDecryptionFailed, keyID)
+	}
+
+	sealed = sealed[1+keyIDSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: value is truncated", errDecryptionFailed)
+	}
+
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDecryptionFailed, err)
+	}
+
+	return value, nil
+}
@@ -1,12 +1,15 @@
 package httpcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"flamingo.me/dingo"
 	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
 	"flamingo.me/flamingo/v3/framework/config"
+	"flamingo.me/flamingo/v3/framework/flamingo"
 )
 
 var ErrRedisConfig = errors.New("redis config not complete")
@@ -14,6 +17,9 @@ var ErrMemoryConfig = errors.New("memory config not complete")
 var ErrTwoLevelConfig = errors.New("twolevel config not complete")
 var ErrInvalidBackend = errors.New("invalid backend supplied")
 
+// shutdownTimeout limits how long the shutdown waits for running background refreshes
+const shutdownTimeout = 10 * time.Second
+
 type (
 	// FrontendFactory that can be used to build caches
 	FrontendFactory struct {
@@ -22,6 +28,7 @@ type (
 		inMemoryBackendFactory *InMemoryBackendFactory
 		twoLevelBackendFactory *TwoLevelBackendFactory
 		cacheConfig            FactoryConfig
+		frontends              []*Frontend
 	}
 
 	// FactoryConfig typed configuration used to build Caches by the factory
@@ -36,6 +43,23 @@ type (
 			First  *BackendConfig
 			Second *BackendConfig
 		}
+		Frontend *FrontendConfig
+	}
+
+	// FrontendConfig typed configuration of the frontend using the configured backend
+	FrontendConfig struct {
+		StaleIfErrorSeconds int
+		Refresh             *RefreshConfig
+		RefreshAhead        *RefreshAheadConfig
+		NegativeCache       *NegativeCacheConfig
+		Cacheability        *DefaultCacheabilityPolicy
+		HeaderFilter        *HeaderFilter
+	}
+
+	// NegativeCacheConfig typed configuration of the negative cache of a frontend
+	NegativeCacheConfig struct {
+		TTLSeconds int
+		Size       int
 	}
 
 	// FrontendProvider - Dingo Provider func
@@ -79,7 +103,16 @@ func (f *FrontendFactory) BindConfiguredCaches(injector *dingo.Injector) error {
 			return err
 		}
 
-		frontend := f.BuildWithBackend(backend)
+		frontend := f.BuildWithContextBackend(backend).SetName(cacheName)
+		if cfg.Frontend != nil {
+			err = configureFrontend(frontend, *cfg.Frontend)
+			if err != nil {
+				return fmt.Errorf("frontend %q: %w", cacheName, err)
+			}
+		}
+
+		f.frontends = append(f.frontends, frontend)
+
 		injector.Bind((*Frontend)(nil)).AnnotatedWith(cacheName).ToInstance(frontend)
 
 		if health, ok := backend.(healthcheck.Status); ok {
@@ -90,18 +123,78 @@ func (f *FrontendFactory) BindConfiguredCaches(injector *dingo.Injector) error {
 	return nil
 }
 
-// BuildWithBackend returns new HTTPFrontend cache with given backend
+// BuildWithBackend returns new HTTPFrontend cache with given backend, the legacy backend is adapted to the ContextBackend contract
 func (f *FrontendFactory) BuildWithBackend(backend Backend) *Frontend {
+	return f.BuildWithContextBackend(AdaptBackend(backend))
+}
+
+// BuildWithContextBackend returns new HTTPFrontend cache with given backend
+func (f *FrontendFactory) BuildWithContextBackend(backend ContextBackend) *Frontend {
 	frontend := f.provider()
 	frontend.backend = backend
 
 	return frontend
 }
 
+// Notify shuts down the configured frontends on application shutdown, so running background refreshes can finish.
+// Their backends are closed afterwards, releasing connections and background tasks.
+func (f *FrontendFactory) Notify(ctx context.Context, event flamingo.Event) {
+	if _, ok := event.(*flamingo.ShutdownEvent); !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	for _, frontend := range f.frontends {
+		if err := frontend.Shutdown(ctx); err != nil && frontend.logger != nil {
+			frontend.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Warn(fmt.Sprintf("Shutdown of frontend %q failed: %v", frontend.name, err))
+		}
+
+		if err := closeBackend(frontend.backend); err != nil && frontend.logger != nil {
+			frontend.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Warn(fmt.Sprintf("Closing the backend of frontend %q failed: %v", frontend.name, err))
+		}
+	}
+}
+
+// configureFrontend applies the frontend configuration
+func configureFrontend(frontend *Frontend, config FrontendConfig) error {
+	frontend.SetStaleIfError(time.Duration(config.StaleIfErrorSeconds) * time.Second)
+
+	if config.Refresh != nil {
+		frontend.SetRefreshConfig(*config.Refresh)
+	}
+
+	if config.NegativeCache != nil {
+		frontend.SetNegativeCache(time.Duration(config.NegativeCache.TTLSeconds)*time.Second, config.NegativeCache.Size)
+	}
+
+	if config.Cacheability != nil {
+		frontend.SetCacheabilityPolicy(*config.Cacheability)
+	}
+
+	if config.HeaderFilter != nil {
+		frontend.SetHeaderFilter(*config.HeaderFilter)
+	}
+
+	if config.RefreshAhead != nil {
+		strategy, err := config.RefreshAhead.Build()
+		if err != nil {
+			return err
+		}
+
+		frontend.SetRefreshAhead(strategy)
+	}
+
+	return nil
+}
+
 // BuildBackend by given BackendConfig and frontendName
 //
 //nolint:cyclop // it is what it is
-func (f *FrontendFactory) BuildBackend(backendConfig BackendConfig, frontendName string) (Backend, error) {
+func (f *FrontendFactory) BuildBackend(backendConfig BackendConfig, frontendName string) (ContextBackend, error) {
 	switch backendConfig.BackendType {
 	case "redis":
 		if backendConfig.Redis == nil {
@@ -137,16 +230,16 @@ func (f *FrontendFactory) BuildBackend(backendConfig BackendConfig, frontendName
 }
 
 // NewMemoryBackend with given config and name
-func (f *FrontendFactory) NewMemoryBackend(config MemoryBackendConfig, frontendName string) (Backend, error) {
+func (f *FrontendFactory) NewMemoryBackend(config MemoryBackendConfig, frontendName string) (ContextBackend, error) {
 	return f.inMemoryBackendFactory.SetConfig(config).SetFrontendName(frontendName).Build()
 }
 
 // NewRedisBackend with given config and name
-func (f *FrontendFactory) NewRedisBackend(config RedisBackendConfig, frontendName string) (Backend, error) {
+func (f *FrontendFactory) NewRedisBackend(config RedisBackendConfig, frontendName string) (ContextBackend, error) {
 	return f.redisBackendFactory.SetConfig(config).SetFrontendName(frontendName).Build()
 }
 
 // NewTwoLevel with given config
-func (f *FrontendFactory) NewTwoLevel(config TwoLevelBackendConfig) (Backend, error) {
+func (f *FrontendFactory) NewTwoLevel(config TwoLevelBackendConfig) (ContextBackend, error) {
 	return f.twoLevelBackendFactory.SetConfig(config).Build()
 }
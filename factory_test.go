@@ -26,6 +26,14 @@ func TestHTTPFrontendFactory_ConfigUnmarshalling(t *testing.T) {
 			"Memory": config.Map{
 				"size": 100.0,
 			},
+			"frontend": config.Map{
+				"staleIfErrorSeconds": 300.0,
+				"cacheability": config.Map{
+					"statusCodes":      config.Slice{200.0, 404.0},
+					"maxBodySize":      1024.0,
+					"forbiddenHeaders": config.Slice{"Set-Cookie"},
+				},
+			},
 		},
 	}
 
@@ -40,6 +48,16 @@ func TestHTTPFrontendFactory_ConfigUnmarshalling(t *testing.T) {
 	assert.Equal(t, "inmemory", one.BackendType)
 	require.NotNil(t, one.Memory)
 	assert.Equal(t, one.Memory.Size, 100)
+	assert.Nil(t, one.Frontend)
+
+	two := typedCacheConfig["two"]
+	require.NotNil(t, two.Frontend)
+	assert.Equal(t, 300, two.Frontend.StaleIfErrorSeconds)
+	assert.Equal(t, &httpcache.DefaultCacheabilityPolicy{
+		StatusCodes:      []int{200, 404},
+		MaxBodySize:      1024,
+		ForbiddenHeaders: []string{"Set-Cookie"},
+	}, two.Frontend.Cacheability)
 }
 
 func TestHTTPFrontendFactory_BuildBackend(t *testing.T) {
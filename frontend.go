@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"flamingo.me/flamingo/v3/framework/flamingo"
@@ -13,13 +16,48 @@ import (
 
 var ErrInvalidEntry = errors.New("cache returned invalid entry type")
 var ErrNoCacheBackend = errors.New("no backend defined")
+var ErrTagsNotSupported = errors.New("backend does not support tags")
+var ErrVariantIndexNotSupported = errors.New("backend does not support variant indexes")
 
 type (
 	// Frontend caches and delivers HTTP responses
 	Frontend struct {
 		singleflight.Group
-		backend Backend
-		logger  flamingo.Logger
+		name          string
+		backend       ContextBackend
+		logger        flamingo.Logger
+		staleIfError  time.Duration
+		refreshAhead  RefreshAheadStrategy
+		negativeCache *negativeCache
+		cacheability  CacheabilityPolicy
+		headerFilter  *HeaderFilter
+		refreshConfig RefreshConfig
+		refresher     *refresher
+		refresherOnce sync.Once
+	}
+
+	// loadRequest describes a load of the entry of a key
+	loadRequest struct {
+		// lookupKey of the entry, used to coalesce loads and in the negative cache
+		lookupKey string
+		// key the entry is stored for, differs from the lookupKey for variants
+		key    string
+		header http.Header
+		// previous entry stored for the lookupKey
+		previous *Entry
+	}
+
+	// loadResult is shared between coalesced loads
+	loadResult struct {
+		entry Entry
+		// storedKey the entry was stored at
+		storedKey string
+		// stored is set if the backend stored the entry
+		stored bool
+		// shared is the entry for coalesced callers, without the headers removed by the header filter
+		shared Entry
+		// coalesced is set if the entry was loaded for a concurrent caller
+		coalesced bool
 	}
 )
 
@@ -32,24 +70,113 @@ func (f *Frontend) Inject(
 	return f
 }
 
-// SetBackend for usage
+// SetName of the frontend, used in metrics
+func (f *Frontend) SetName(name string) *Frontend {
+	f.name = name
+
+	return f
+}
+
+// SetBackend for usage, the legacy backend is adapted to the ContextBackend contract
 func (f *Frontend) SetBackend(b Backend) *Frontend {
+	f.backend = AdaptBackend(b)
+
+	return f
+}
+
+// SetContextBackend for usage
+func (f *Frontend) SetContextBackend(b ContextBackend) *Frontend {
 	f.backend = b
 
 	return f
 }
 
+// SetStaleIfError enables serving entries for the given window beyond their GraceTime if the loader fails.
+// Loaded entries without a Meta.StaleTime get one set, so backends keep them long enough.
+func (f *Frontend) SetStaleIfError(window time.Duration) *Frontend {
+	f.staleIfError = window
+
+	return f
+}
+
+// SetRefreshConfig for the executor of background refreshes, must be set before the first call to Get
+func (f *Frontend) SetRefreshConfig(config RefreshConfig) *Frontend {
+	f.refreshConfig = config
+
+	return f
+}
+
+// SetRefreshAhead enables refreshing fresh entries in background before their LifeTime ends, nil disables it
+func (f *Frontend) SetRefreshAhead(strategy RefreshAheadStrategy) *Frontend {
+	f.refreshAhead = strategy
+
+	return f
+}
+
+// SetNegativeCache remembers loader errors for the given ttl in up to size keys, so a failing upstream is not called
+// on every request. Get returns a NegativeCacheError wrapping the remembered error meanwhile. A ttl of 0 disables it.
+func (f *Frontend) SetNegativeCache(ttl time.Duration, size int) *Frontend {
+	f.negativeCache = nil
+	if ttl > 0 {
+		f.negativeCache = newNegativeCache(ttl, size)
+	}
+
+	return f
+}
+
+// SetCacheabilityPolicy decides which loaded entries are stored, nil stores every entry
+func (f *Frontend) SetCacheabilityPolicy(policy CacheabilityPolicy) *Frontend {
+	f.cacheability = policy
+
+	return f
+}
+
+// SetHeaderFilter removing headers of loaded entries before they are stored.
+// By default hop-by-hop headers and Set-Cookie are removed.
+func (f *Frontend) SetHeaderFilter(filter HeaderFilter) *Frontend {
+	f.headerFilter = &filter
+
+	return f
+}
+
+// Shutdown stops background refreshes and waits for the running ones until the context is done
+func (f *Frontend) Shutdown(ctx context.Context) error {
+	return f.getRefresher().shutdown(ctx)
+}
+
+func (f *Frontend) getHeaderFilter() HeaderFilter {
+	if f.headerFilter == nil {
+		return defaultHeaderFilter
+	}
+
+	return *f.headerFilter
+}
+
+func (f *Frontend) getRefresher() *refresher {
+	f.refresherOnce.Do(func() {
+		f.refresher = newRefresher(f.refreshConfig, newFrontendMetrics(f.name))
+	})
+
+	return f.refresher
+}
+
+// Purge a cache key including all its variants
 func (f *Frontend) Purge(ctx context.Context, key string) error {
 	if f.backend == nil {
 		return ErrNoCacheBackend
 	}
 
-	_, span := trace.StartSpan(ctx, "flamingo/httpcache/purge")
+	ctx, span := trace.StartSpan(ctx, "flamingo/httpcache/purge")
 
 	span.Annotate(nil, key)
 	defer span.End()
 
-	err := f.backend.Purge(key)
+	if f.negativeCache != nil {
+		f.negativeCache.remove(key)
+		f.negativeCache.removeVariants(key)
+	}
+
+	err := errors.Join(f.purgeVariants(ctx, key), f.backend.Purge(ctx, key))
 	if err != nil {
 		return fmt.Errorf("failed to purge with key: %s: %w", key, err)
 	}
@@ -57,11 +184,93 @@ func (f *Frontend) Purge(ctx context.Context, key string) error {
 	return nil
 }
 
+// PurgeTags purges all entries carrying one of the tags, returns ErrTagsNotSupported if the backend can't handle tags
+func (f *Frontend) PurgeTags(ctx context.Context, tags ...string) error {
+	_, err := f.PurgeTagsWithCount(ctx, tags...)
+
+	return err
+}
+
+// PurgeTagsWithCount purges all entries carrying one of the tags and returns the number of purged entries,
+// which is -1 if the backend does not count them. Returns ErrTagsNotSupported if the backend can't handle tags.
+func (f *Frontend) PurgeTagsWithCount(ctx context.Context, tags ...string) (int, error) {
+	if f.backend == nil {
+		return 0, ErrNoCacheBackend
+	}
+
+	ctx, span := trace.StartSpan(ctx, "flamingo/httpcache/purgeTags")
+
+	span.Annotate(nil, strings.Join(tags, ","))
+	defer span.End()
+
+	tagSupporting, ok := f.backend.(ContextTagSupporting)
+	if !ok {
+		return 0, ErrTagsNotSupported
+	}
+
+	purged := -1
+
+	var err error
+
+	if tagCounting, ok := f.backend.(ContextTagCounting); ok {
+		purged, err = tagCounting.PurgeTagsWithCount(ctx, tags)
+	} else {
+		err = tagSupporting.PurgeTags(ctx, tags)
+	}
+
+	if err != nil {
+		return purged, fmt.Errorf("failed to purge tags: %v: %w", tags, err)
+	}
+
+	return purged, nil
+}
+
+// Flush purges all entries of the backend
+func (f *Frontend) Flush(ctx context.Context) error {
+	if f.backend == nil {
+		return ErrNoCacheBackend
+	}
+
+	ctx, span := trace.StartSpan(ctx, "flamingo/httpcache/flush")
+	defer span.End()
+
+	if f.negativeCache != nil {
+		f.negativeCache.purge()
+	}
+
+	err := f.backend.Flush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+
+	return nil
+}
+
 // Get the cached response if possible or perform a call to loader
 // The result of loader will be returned and cached
 func (f *Frontend) Get(ctx context.Context, key string, loader HTTPLoader) (Entry, error) {
+	entry, _, err := f.GetVariantWithInfo(ctx, key, nil, loader)
+
+	return entry, err
+}
+
+// GetWithInfo is Get additionally describing how the entry was served
+func (f *Frontend) GetWithInfo(ctx context.Context, key string, loader HTTPLoader) (Entry, CacheInfo, error) {
+	return f.GetVariantWithInfo(ctx, key, nil, loader)
+}
+
+// GetVariant is Get for responses with a Vary header: their variants are stored separately next to a variant index
+// at the key, and the variant matching the values of the selecting request headers is returned
+func (f *Frontend) GetVariant(ctx context.Context, key string, requestHeader http.Header, loader HTTPLoader) (Entry, error) {
+	entry, _, err := f.GetVariantWithInfo(ctx, key, requestHeader, loader)
+
+	return entry, err
+}
+
+// GetVariantWithInfo is GetVariant additionally describing how the entry was served
+func (f *Frontend) GetVariantWithInfo(ctx context.Context, key string, requestHeader http.Header, loader HTTPLoader) (Entry, CacheInfo, error) {
 	if f.backend == nil {
-		return Entry{}, ErrNoCacheBackend
+		return Entry{}, CacheInfo{Status: CacheStatusMiss}, ErrNoCacheBackend
 	}
 
 	ctx, span := trace.StartSpan(ctx, "flamingo/httpcache/get")
@@ -69,37 +278,129 @@ func (f *Frontend) Get(ctx context.Context, key string, loader HTTPLoader) (Entr
 
 	defer span.End()
 
-	if entry, ok := f.backend.Get(key); ok {
-		if entry.Meta.LifeTime.After(time.Now()) {
+	lookupKey := key
+	lookupCtx, servingBackend := withServingBackend(ctx)
+
+	entry, found := f.lookup(lookupCtx, key)
+	if found && isVariantIndex(entry) {
+		lookupKey = variantKey(key, varyHeaderNames(entry.Header), requestHeader)
+		entry, found = f.lookup(lookupCtx, lookupKey)
+	}
+
+	request := loadRequest{lookupKey: lookupKey, key: key, header: requestHeader}
+
+	if found {
+		request.previous = &entry
+		now := time.Now()
+
+		if entry.Meta.LifeTime.After(now) {
+			if f.refreshAhead != nil && f.refreshAhead.ShouldRefresh(entry, now) {
+				f.logger.WithContext(ctx).
+					WithField(flamingo.LogKeyCategory, "httpcache").
+					Debug("Refresh ahead of lifetime: ", lookupKey)
+
+				f.refreshInBackground(ctx, request, loader)
+			}
+
 			f.logger.WithContext(ctx).
 				WithField(flamingo.LogKeyCategory, "httpcache").
-				Debug("Serving from cache: ", key)
+				Debug("Serving from cache: ", lookupKey)
 
-			return entry, nil
+			return entry, f.cacheInfo(CacheStatusHit, entry, *servingBackend), nil
 		}
 
-		if entry.Meta.GraceTime.After(time.Now()) {
+		if entry.Meta.GraceTime.After(now) {
 			// Try to load the actual value in background
-			go func() {
-				_, _ = f.load(ctx, key, loader)
-			}()
+			f.refreshInBackground(ctx, request, loader)
 
 			f.logger.WithContext(ctx).
 				WithField(flamingo.LogKeyCategory, "httpcache").
-				Debug("Gracetime! Serving from cache: ", key)
+				Debug("Gracetime! Serving from cache: ", lookupKey)
 
-			return entry, nil
+			return entry, f.cacheInfo(CacheStatusStale, entry, *servingBackend), nil
 		}
 	}
 
 	f.logger.WithContext(ctx).
 		WithField(flamingo.LogKeyCategory, "httpcache").
-		Debug("No cache entry for: ", key)
+		Debug("No cache entry for: ", lookupKey)
+
+	result, err := f.load(ctx, request, loader)
+	if err == nil {
+		// a coalesced load may have created the variant of another request
+		if names := varyHeaderNames(result.entry.Header); len(names) > 0 && result.storedKey != "" {
+			if ownKey := variantKey(key, names, requestHeader); ownKey != result.storedKey {
+				result, err = f.load(ctx, loadRequest{lookupKey: ownKey, key: key, header: requestHeader}, loader)
+			}
+		}
+	}
+
+	if err != nil && found && f.staleUntil(entry).After(time.Now()) {
+		span.Annotate(nil, "stale-if-error: "+err.Error())
+		f.logger.WithContext(ctx).
+			WithField(flamingo.LogKeyCategory, "httpcache").
+			Warn(fmt.Sprintf("Loader failed, serving stale entry for key %q: %v", lookupKey, err))
 
-	return f.load(ctx, key, loader)
+		return entry, f.cacheInfo(CacheStatusErrorStale, entry, *servingBackend), nil
+	}
+
+	status := CacheStatusMiss
+	if result.coalesced {
+		status = CacheStatusCoalesced
+	}
+
+	info := f.cacheInfo(status, result.entry, "")
+	info.Stored = result.stored
+
+	return result.entry, info, err
 }
 
-func (f *Frontend) load(ctx context.Context, key string, loader HTTPLoader) (Entry, error) { //nolint:contextcheck // this is fine
+// lookup the key in the backend, a broken backend must not break the caller, so errors are logged and treated as miss
+func (f *Frontend) lookup(ctx context.Context, key string) (Entry, bool) {
+	// the backend of a previous lookup, e.g. of the variant index, must not be reported for this one
+	ReportServingBackend(ctx, "")
+
+	entry, found, err := f.backend.Get(ctx, key)
+	if err != nil {
+		trace.FromContext(ctx).Annotate(nil, "backend error: "+err.Error())
+		f.logger.WithContext(ctx).
+			WithField(flamingo.LogKeyCategory, "httpcache").
+			Error(fmt.Sprintf("Backend failed to get key %q: %v", key, err))
+	}
+
+	return entry, found
+}
+
+// refreshInBackground queues a load of the key in the bounded refresh executor.
+// The refresh may run after the request is done, so it doesn't inherit its deadline but has its own timeout.
+func (f *Frontend) refreshInBackground(ctx context.Context, request loadRequest, loader HTTPLoader) {
+	request.header = request.header.Clone()
+	timeout := f.refreshConfig.timeout()
+
+	queued := f.getRefresher().submit(request.lookupKey, func() {
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+
+		_, _ = f.load(refreshCtx, request, loader)
+	})
+	if !queued {
+		f.logger.WithContext(ctx).
+			WithField(flamingo.LogKeyCategory, "httpcache").
+			Debug("Refresh queue full, dropped background refresh for: ", request.lookupKey)
+	}
+}
+
+// staleUntil returns the point in time until the entry may be served if the loader fails
+func (f *Frontend) staleUntil(entry Entry) time.Time {
+	if !entry.Meta.StaleTime.IsZero() {
+		return entry.Meta.StaleTime
+	}
+
+	return entry.Meta.GraceTime.Add(f.staleIfError)
+}
+
+// load the entry of the request and store it
+func (f *Frontend) load(ctx context.Context, request loadRequest, loader HTTPLoader) (loadResult, error) { //nolint:contextcheck // this is fine
 	oldSpan := trace.FromContext(ctx)
 	newContext := trace.NewContext(context.Background(), oldSpan)
 
@@ -114,13 +415,26 @@ func (f *Frontend) load(ctx context.Context, key string, loader HTTPLoader) (Ent
 
 	newContextWithSpan, span := trace.StartSpan(newContext, "flamingo/httpcache/load")
 
-	span.Annotate(nil, key)
+	span.Annotate(nil, request.lookupKey)
 
 	defer span.End()
 
-	data, err, _ := f.Do(key, func() (res interface{}, resultErr error) {
+	if f.negativeCache != nil {
+		if cachedErr := f.negativeCache.get(request.lookupKey); cachedErr != nil {
+			newFrontendMetrics(f.name).countNegativeHit()
+			span.Annotate(nil, "negative cache hit")
+
+			return loadResult{}, cachedErr
+		}
+	}
+
+	executed := false
+
+	fetch := func() (res interface{}, resultErr error) {
+		executed = true
+
 		ctx, fetchRoutineSpan := trace.StartSpan(newContextWithSpan, "flamingo/httpcache/fetchRoutine")
-		fetchRoutineSpan.Annotate(nil, key)
+		fetchRoutineSpan.Annotate(nil, request.lookupKey)
 		defer fetchRoutineSpan.End()
 
 		defer func() {
@@ -135,31 +449,124 @@ func (f *Frontend) load(ctx context.Context, key string, loader HTTPLoader) (Ent
 			}
 		}()
 
-		entry, err := loader(ctx)
+		start := time.Now()
+
+		loaderCtx := ctx
+
+		var previous *Entry
+
+		if request.previous != nil {
+			// loaders and the revalidation work on the uncompressed body, backends may return compressed ones
+			decompressed, err := decompressEntry(*request.previous)
+			if err != nil {
+				return nil, err
+			}
+
+			previous = &decompressed
+			loaderCtx = withPreviousEntry(ctx, decompressed)
+		}
+
+		entry, err := loader(loaderCtx)
 		if err != nil {
 			return nil, err
 		}
 
+		notModified := entry.Meta.Revalidated
+		if notModified {
+			if previous == nil {
+				return nil, ErrNotModifiedWithoutEntry
+			}
+
+			entry = revalidated(*previous, entry)
+		} else if isNotModified(entry) {
+			// the loader didn't revalidate the stored entry, e.g. it passed conditional headers of the client on
+			entry.Meta.NoStore = true
+		}
+
+		if entry.Meta.CreatedAt.IsZero() {
+			entry.Meta.CreatedAt = time.Now()
+		}
+
+		if entry.Meta.LoadDuration == 0 {
+			entry.Meta.LoadDuration = time.Since(start)
+		}
+
+		if f.staleIfError > 0 && entry.Meta.StaleTime.IsZero() {
+			entry.Meta.StaleTime = entry.Meta.GraceTime.Add(f.staleIfError)
+		}
+
+		// the caller gets the loaded entry, the backend and coalesced callers must not see headers meant for the caller
+		shared := entry
+		shared.Header = f.getHeaderFilter().Filter(entry.Header)
+
+		if entry.Meta.NoStore || f.cacheability != nil && !f.cacheability.IsCacheable(entry) {
+			newFrontendMetrics(f.name).countUncacheable()
+			fetchRoutineSpan.Annotate(nil, "not cacheable")
+			f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Debug("Entry is not cacheable, not storing key: ", request.lookupKey)
+
+			return loadResult{entry: entry, shared: shared}, nil
+		}
+
+		if !shared.Meta.KeepUntil().After(time.Now()) {
+			// entries expiring right away, e.g. with max-age=0 and without grace time, would be rejected by the backends
+			fetchRoutineSpan.Annotate(nil, "expired")
+			f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Debug("Entry is already expired, not storing key: ", request.lookupKey)
+
+			return loadResult{entry: entry, shared: shared}, nil
+		}
+
 		ctx, setSpan := trace.StartSpan(ctx, "flamingo/httpcache/set")
 
-		setSpan.Annotate(nil, key)
+		setSpan.Annotate(nil, request.key)
 		defer setSpan.End()
 
 		f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
-			Debugf("Store entry in Cache for key: %s", key)
+			Debugf("Store entry in Cache for key: %s", request.key)
 
-		_ = f.backend.Set(key, entry)
+		storedKey, err := f.store(ctx, request.key, request.header, shared, notModified)
+
+		var expired *ExpiredEntryError
+
+		switch {
+		case errors.As(err, &expired):
+			// the entry expired while it was stored, which is a skipped write rather than a failing backend
+			f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Debug(fmt.Sprintf("Entry expired while storing key %q: %v", request.key, err))
+		case err != nil:
+			f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+				Error(fmt.Sprintf("Failed to store entry in Cache for key %q: %v", request.key, err))
+		}
+
+		return loadResult{entry: entry, storedKey: storedKey, stored: storedKey != "" && err == nil, shared: shared}, nil
+	}
+
+	data, err, _ := f.Do(request.lookupKey, fetch)
+	if result, ok := data.(loadResult); ok && !executed && result.shared.Meta.NoStore {
+		// entries which must not be stored are meant for a single caller, so a coalesced caller loads its own
+		data, err = fetch()
+	}
 
-		return entry, err
-	})
 	if err != nil {
-		return Entry{}, fmt.Errorf("http loader error: %w", err)
+		err = fmt.Errorf("http loader error: %w", err)
+
+		if f.negativeCache != nil {
+			f.negativeCache.add(request.lookupKey, err)
+		}
+
+		return loadResult{}, err
 	}
 
-	entry, ok := data.(Entry)
+	result, ok := data.(loadResult)
 	if !ok {
-		return Entry{}, ErrInvalidEntry
+		return loadResult{}, ErrInvalidEntry
+	}
+
+	result.coalesced = !executed
+	if result.coalesced {
+		result.entry = result.shared
 	}
 
-	return entry, nil
+	return result, nil
 }
@@ -2,8 +2,12 @@ package httpcache_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -54,7 +58,7 @@ func TestFrontend_Get(t *testing.T) {
 
 	tests := []struct {
 		name             string
-		cacheGetter      func() (httpcache.Entry, bool)
+		cacheGetter      func() (httpcache.Entry, bool, error)
 		args             args
 		want             httpcache.Entry
 		wantSet          *httpcache.Entry
@@ -63,14 +67,14 @@ func TestFrontend_Get(t *testing.T) {
 	}{
 		{
 			name:             "in cache and in lifetime",
-			cacheGetter:      func() (httpcache.Entry, bool) { return defaultEntry, true },
+			cacheGetter:      func() (httpcache.Entry, bool, error) { return defaultEntry, true, nil },
 			want:             defaultEntry,
 			wantErr:          false,
 			wantLoaderCalled: false,
 		},
 		{
 			name:        "not in cache",
-			cacheGetter: func() (httpcache.Entry, bool) { return httpcache.Entry{}, false },
+			cacheGetter: func() (httpcache.Entry, bool, error) { return httpcache.Entry{}, false, nil },
 			args: args{
 				loader: func(_ context.Context) (httpcache.Entry, error) {
 					return defaultEntry, nil
@@ -82,7 +86,7 @@ func TestFrontend_Get(t *testing.T) {
 		},
 		{
 			name:        "in cache but not in lifetime/gracetime",
-			cacheGetter: func() (httpcache.Entry, bool) { return defaultOldEntry, true },
+			cacheGetter: func() (httpcache.Entry, bool, error) { return defaultOldEntry, true, nil },
 			args: args{
 				loader: func(_ context.Context) (httpcache.Entry, error) {
 					return defaultEntry, nil
@@ -94,7 +98,7 @@ func TestFrontend_Get(t *testing.T) {
 		},
 		{
 			name:        "in cache, not in lifetime, in gracetime",
-			cacheGetter: func() (httpcache.Entry, bool) { return defaultGraceEntry, true },
+			cacheGetter: func() (httpcache.Entry, bool, error) { return defaultGraceEntry, true, nil },
 			args: args{
 				loader: func(_ context.Context) (httpcache.Entry, error) {
 					return defaultEntry, nil
@@ -104,9 +108,21 @@ func TestFrontend_Get(t *testing.T) {
 			wantErr:          false,
 			wantLoaderCalled: true,
 		},
+		{
+			name:        "backend fails, loaded as miss",
+			cacheGetter: func() (httpcache.Entry, bool, error) { return httpcache.Entry{}, false, errors.New("backend down") },
+			args: args{
+				loader: func(_ context.Context) (httpcache.Entry, error) {
+					return defaultEntry, nil
+				}},
+			want:             defaultEntry,
+			wantSet:          &defaultEntry,
+			wantErr:          false,
+			wantLoaderCalled: true,
+		},
 		{
 			name:        "not in cache, loader panics",
-			cacheGetter: func() (httpcache.Entry, bool) { return httpcache.Entry{}, false },
+			cacheGetter: func() (httpcache.Entry, bool, error) { return httpcache.Entry{}, false, nil },
 			args: args{
 				loader: func(_ context.Context) (httpcache.Entry, error) {
 					panic("test panic")
@@ -129,21 +145,24 @@ func TestFrontend_Get(t *testing.T) {
 				return test.args.loader(ctx)
 			}
 
-			backend := new(mocks.Backend)
+			backend := new(mocks.ContextBackend)
 
 			if test.cacheGetter != nil {
-				backend.EXPECT().Get(testKey).Return(test.cacheGetter())
+				backend.EXPECT().Get(mock.Anything, testKey).Return(test.cacheGetter())
 			}
 
 			if test.wantSet != nil {
-				backend.EXPECT().Set(testKey, *test.wantSet).Run(func(key string, entry httpcache.Entry) {
+				wantSet := *test.wantSet
+				backend.EXPECT().Set(mock.Anything, testKey, mock.MatchedBy(func(entry httpcache.Entry) bool {
+					return assert.ObjectsAreEqual(wantSet, withoutLoadMeta(entry))
+				})).Run(func(_ context.Context, key string, entry httpcache.Entry) {
 					wait <- struct{}{}
 				}).Return(nil).Once()
 			} else {
 				close(wait)
 			}
 
-			f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(backend)
+			f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
 			got, err := f.Get(context.Background(), testKey, loader)
 
 			// wait for eventually async cache set to be finished
@@ -159,27 +178,35 @@ func TestFrontend_Get(t *testing.T) {
 				return
 			}
 
-			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.want, withoutLoadMeta(got))
 		})
 	}
 }
 
+// withoutLoadMeta removes the meta data set by the frontend while loading
+func withoutLoadMeta(entry httpcache.Entry) httpcache.Entry {
+	entry.Meta.CreatedAt = time.Time{}
+	entry.Meta.LoadDuration = 0
+
+	return entry
+}
+
 func TestContextDeadlineExceeded(t *testing.T) {
 	t.Parallel()
 
 	t.Run("exceeded, throw error", func(t *testing.T) {
 		t.Parallel()
 
-		backend := new(mocks.Backend)
+		backend := new(mocks.ContextBackend)
 
-		backend.EXPECT().Get(testKey).Return(func() (httpcache.Entry, bool) { return httpcache.Entry{}, false }())
+		backend.EXPECT().Get(mock.Anything, testKey).Return(func() (httpcache.Entry, bool, error) { return httpcache.Entry{}, false, nil }())
 
-		backend.EXPECT().Set(mock.Anything, mock.Anything).Return(nil)
+		backend.EXPECT().Set(mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 		contextWithDeadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(4*time.Second))
 		t.Cleanup(cancel)
 
-		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(backend)
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
 		got, err := f.Get(contextWithDeadline, testKey, loaderWithWaitingTime)
 
 		assert.ErrorIs(t, err, context.DeadlineExceeded)
@@ -189,16 +216,16 @@ func TestContextDeadlineExceeded(t *testing.T) {
 	t.Run("did not exceed, no error", func(t *testing.T) {
 		t.Parallel()
 
-		backend := new(mocks.Backend)
+		backend := new(mocks.ContextBackend)
 
-		backend.EXPECT().Get(testKey).Return(func() (httpcache.Entry, bool) { return httpcache.Entry{}, false }())
+		backend.EXPECT().Get(mock.Anything, testKey).Return(func() (httpcache.Entry, bool, error) { return httpcache.Entry{}, false, nil }())
 
-		backend.EXPECT().Set(mock.Anything, mock.Anything).Return(nil)
+		backend.EXPECT().Set(mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 		contextWithDeadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(6*time.Second))
 		t.Cleanup(cancel)
 
-		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(backend)
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
 		got, err := f.Get(contextWithDeadline, testKey, loaderWithWaitingTime)
 
 		assert.NoError(t, err)
@@ -244,3 +271,949 @@ func loaderWithWaitingTime(ctx context.Context) (httpcache.Entry, error) {
 		Body:       []byte("body"),
 	}, nil
 }
+
+func TestFrontend_SetBackend(t *testing.T) {
+	t.Parallel()
+
+	entry := createEntry(t, "10s", "15s", nil, nil, "200 OK", http.StatusOK, "legacy")
+
+	backend := new(mocks.Backend)
+	backend.EXPECT().Get(testKey).Return(entry, true).Once()
+
+	f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(backend)
+	got, err := f.Get(context.Background(), testKey, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, entry, got)
+	backend.AssertExpectations(t)
+}
+
+func TestFrontend_StaleIfError(t *testing.T) {
+	t.Parallel()
+
+	failingLoader := func(_ context.Context) (httpcache.Entry, error) {
+		return httpcache.Entry{}, errors.New("upstream down")
+	}
+
+	t.Run("loader fails, stale entry within window is served", func(t *testing.T) {
+		t.Parallel()
+
+		staleEntry := createEntry(t, "-20s", "-10s", nil, nil, "200 OK", http.StatusOK, "stale")
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(staleEntry, true, nil)
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).SetStaleIfError(time.Minute)
+		got, err := f.Get(context.Background(), testKey, failingLoader)
+
+		assert.NoError(t, err)
+		assert.Equal(t, staleEntry, got)
+	})
+
+	t.Run("loader fails, stale entry outside window returns error", func(t *testing.T) {
+		t.Parallel()
+
+		staleEntry := createEntry(t, "-20m", "-10m", nil, nil, "200 OK", http.StatusOK, "stale")
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(staleEntry, true, nil)
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).SetStaleIfError(time.Minute)
+		got, err := f.Get(context.Background(), testKey, failingLoader)
+
+		assert.Error(t, err)
+		assert.Equal(t, httpcache.Entry{}, got)
+	})
+
+	t.Run("loader fails, stale time of entry overrides window", func(t *testing.T) {
+		t.Parallel()
+
+		staleEntry := createEntry(t, "-20m", "-10m", nil, nil, "200 OK", http.StatusOK, "stale")
+		staleEntry.Meta.StaleTime = time.Now().Add(time.Minute)
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(staleEntry, true, nil)
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+		got, err := f.Get(context.Background(), testKey, failingLoader)
+
+		assert.NoError(t, err)
+		assert.Equal(t, staleEntry, got)
+	})
+
+	t.Run("loaded entry gets stale time", func(t *testing.T) {
+		t.Parallel()
+
+		entry := createEntry(t, "10s", "20s", nil, nil, "200 OK", http.StatusOK, "fresh")
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(httpcache.Entry{}, false, nil)
+		backend.EXPECT().Set(mock.Anything, testKey, mock.Anything).Run(func(_ context.Context, _ string, stored httpcache.Entry) {
+			assert.True(t, stored.Meta.StaleTime.Equal(entry.Meta.GraceTime.Add(time.Minute)))
+			assert.True(t, stored.Meta.KeepUntil().Equal(stored.Meta.StaleTime))
+		}).Return(nil).Once()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).SetStaleIfError(time.Minute)
+		_, err := f.Get(context.Background(), testKey, func(_ context.Context) (httpcache.Entry, error) {
+			return entry, nil
+		})
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestFrontend_BackgroundRefresh(t *testing.T) {
+	t.Parallel()
+
+	graceEntry := createEntry(t, "-10s", "15s", nil, nil, "200 OK", http.StatusOK, "grace")
+	freshEntry := createEntry(t, "10s", "15s", nil, nil, "200 OK", http.StatusOK, "fresh")
+
+	setup := func(t *testing.T) (*httpcache.Frontend, chan string, chan struct{}, func(key string) httpcache.HTTPLoader) {
+		t.Helper()
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, mock.Anything).Return(graceEntry, true, nil)
+		backend.EXPECT().Set(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+		started := make(chan string, 10)
+		release := make(chan struct{})
+		loader := func(key string) httpcache.HTTPLoader {
+			return func(_ context.Context) (httpcache.Entry, error) {
+				started <- key
+				<-release
+
+				return freshEntry, nil
+			}
+		}
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).
+			SetRefreshConfig(httpcache.RefreshConfig{Concurrency: 1, QueueSize: 1, DropPolicy: httpcache.RefreshDropNewest})
+
+		return f, started, release, loader
+	}
+
+	t.Run("queue is bounded and shutdown waits for running refresh", func(t *testing.T) {
+		t.Parallel()
+
+		f, started, release, loader := setup(t)
+
+		got, err := f.Get(context.Background(), "one", loader("one"))
+		require.NoError(t, err)
+		assert.Equal(t, graceEntry, got)
+		assert.Equal(t, "one", <-started)
+
+		// worker is busy: "two" is queued, "three" is dropped
+		_, _ = f.Get(context.Background(), "two", loader("two"))
+		_, _ = f.Get(context.Background(), "three", loader("three"))
+
+		shutdownDone := make(chan error)
+
+		go func() {
+			shutdownDone <- f.Shutdown(context.Background())
+		}()
+
+		select {
+		case <-shutdownDone:
+			t.Fatal("shutdown returned while refresh was running")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		require.NoError(t, <-shutdownDone)
+
+		// queued refresh was dropped on shutdown
+		assert.Empty(t, started)
+	})
+
+	t.Run("shutdown gives up when context is done", func(t *testing.T) {
+		t.Parallel()
+
+		f, started, release, loader := setup(t)
+		t.Cleanup(func() { close(release) })
+
+		_, _ = f.Get(context.Background(), "one", loader("one"))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		t.Cleanup(cancel)
+
+		assert.ErrorIs(t, f.Shutdown(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("queued refresh is detached from the deadline of the request", func(t *testing.T) {
+		t.Parallel()
+
+		f, started, release, loader := setup(t)
+
+		_, _ = f.Get(context.Background(), "slow", loader("slow"))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		t.Cleanup(cancel)
+
+		refreshErr := make(chan error, 1)
+		_, _ = f.Get(ctx, "queued", func(ctx context.Context) (httpcache.Entry, error) {
+			refreshErr <- ctx.Err()
+
+			return freshEntry, nil
+		})
+
+		// the queued refresh starts after the request deadline
+		<-ctx.Done()
+		close(release)
+
+		require.NoError(t, <-refreshErr)
+		require.NoError(t, f.Shutdown(context.Background()))
+	})
+}
+
+func TestFrontend_RefreshAhead(t *testing.T) {
+	t.Parallel()
+
+	entry := createEntry(t, "10s", "15s", nil, nil, "200 OK", http.StatusOK, "almost expired")
+	entry.Meta.CreatedAt = time.Now().Add(-90 * time.Second)
+
+	refreshed := make(chan httpcache.Entry, 1)
+
+	backend := new(mocks.ContextBackend)
+	backend.EXPECT().Get(mock.Anything, testKey).Return(entry, true, nil)
+	backend.EXPECT().Set(mock.Anything, testKey, mock.Anything).Run(func(_ context.Context, _ string, stored httpcache.Entry) {
+		refreshed <- stored
+	}).Return(nil).Once()
+
+	f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).
+		SetRefreshAhead(httpcache.LifetimeRatioRefreshAhead{Ratio: 0.8})
+
+	got, err := f.Get(context.Background(), testKey, func(_ context.Context) (httpcache.Entry, error) {
+		return createEntry(t, "100s", "150s", nil, nil, "200 OK", http.StatusOK, "refreshed"), nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, entry, got, "fresh entry is served while refreshing")
+	assert.Equal(t, []byte("refreshed"), (<-refreshed).Body)
+}
+
+func TestFrontend_NegativeCache(t *testing.T) {
+	t.Parallel()
+
+	errUpstream := errors.New("upstream down")
+
+	backend := new(mocks.ContextBackend)
+	backend.EXPECT().Get(mock.Anything, testKey).Return(httpcache.Entry{}, false, nil)
+	backend.EXPECT().Purge(mock.Anything, testKey).Return(nil)
+
+	loaderCalls := 0
+	loader := func(_ context.Context) (httpcache.Entry, error) {
+		loaderCalls++
+
+		return httpcache.Entry{}, errUpstream
+	}
+
+	f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).SetNegativeCache(time.Minute, 10)
+
+	_, err := f.Get(context.Background(), testKey, loader)
+	require.ErrorIs(t, err, errUpstream)
+
+	var negativeErr *httpcache.NegativeCacheError
+	assert.False(t, errors.As(err, &negativeErr), "first error is not cached yet")
+
+	_, err = f.Get(context.Background(), testKey, loader)
+	require.ErrorAs(t, err, &negativeErr)
+	assert.ErrorIs(t, err, errUpstream)
+	assert.Equal(t, testKey, negativeErr.Key)
+	assert.Equal(t, 1, loaderCalls)
+
+	require.NoError(t, f.Purge(context.Background(), testKey))
+
+	_, err = f.Get(context.Background(), testKey, loader)
+	assert.False(t, errors.As(err, &negativeErr), "purge removes negative entry")
+	assert.Equal(t, 2, loaderCalls)
+}
+
+// slowGetBackend delays the result of every Get, so concurrent callers read the same state
+type slowGetBackend struct {
+	*httpcache.MemoryBackend
+	delay time.Duration
+}
+
+func (b slowGetBackend) Get(ctx context.Context, key string) (httpcache.Entry, bool, error) {
+	entry, found, err := b.MemoryBackend.Get(ctx, key)
+
+	time.Sleep(b.delay)
+
+	return entry, found, err //nolint:wrapcheck // test wrapper
+}
+
+type tagSupportingBackend struct {
+	*mocks.ContextBackend
+	*mocks.ContextTagSupporting
+}
+
+func TestFrontend_PurgeTags(t *testing.T) {
+	t.Parallel()
+
+	t.Run("backend supports tags", func(t *testing.T) {
+		t.Parallel()
+
+		tags := mocks.NewContextTagSupporting(t)
+		tags.EXPECT().PurgeTags(mock.Anything, []string{"one", "two"}).Return(nil).Once()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).
+			SetContextBackend(tagSupportingBackend{ContextBackend: mocks.NewContextBackend(t), ContextTagSupporting: tags})
+
+		assert.NoError(t, f.PurgeTags(context.Background(), "one", "two"))
+	})
+
+	t.Run("backend counts purged entries", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+
+		for _, key := range []string{"one", "two", "three"} {
+			_, err := f.Get(t.Context(), key, func(context.Context) (httpcache.Entry, error) {
+				return httpcache.Entry{
+					Meta: httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute), Tags: []string{key}},
+				}, nil
+			})
+			require.NoError(t, err)
+		}
+
+		purged, err := f.PurgeTagsWithCount(t.Context(), "one", "two")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, purged)
+	})
+
+	t.Run("backend without purge count", func(t *testing.T) {
+		t.Parallel()
+
+		tags := mocks.NewContextTagSupporting(t)
+		tags.EXPECT().PurgeTags(mock.Anything, []string{"one"}).Return(nil).Once()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).
+			SetContextBackend(tagSupportingBackend{ContextBackend: mocks.NewContextBackend(t), ContextTagSupporting: tags})
+
+		purged, err := f.PurgeTagsWithCount(context.Background(), "one")
+		assert.NoError(t, err)
+		assert.Equal(t, -1, purged)
+	})
+
+	t.Run("backend fails", func(t *testing.T) {
+		t.Parallel()
+
+		errBackend := errors.New("backend down")
+
+		tags := mocks.NewContextTagSupporting(t)
+		tags.EXPECT().PurgeTags(mock.Anything, []string{"one"}).Return(errBackend).Once()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).
+			SetContextBackend(tagSupportingBackend{ContextBackend: mocks.NewContextBackend(t), ContextTagSupporting: tags})
+
+		assert.ErrorIs(t, f.PurgeTags(context.Background(), "one"), errBackend)
+	})
+
+	t.Run("backend without tag support", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(mocks.NewContextBackend(t))
+
+		assert.ErrorIs(t, f.PurgeTags(context.Background(), "one"), httpcache.ErrTagsNotSupported)
+	})
+
+	t.Run("legacy backend without tag support", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetBackend(mocks.NewBackend(t))
+
+		assert.ErrorIs(t, f.PurgeTags(context.Background(), "one"), httpcache.ErrTagsNotSupported)
+	})
+
+	t.Run("no backend", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger))
+
+		assert.ErrorIs(t, f.PurgeTags(context.Background(), "one"), httpcache.ErrNoCacheBackend)
+	})
+}
+
+func TestFrontend_Flush(t *testing.T) {
+	t.Parallel()
+
+	backend := mocks.NewContextBackend(t)
+	backend.EXPECT().Flush(mock.Anything).Return(nil).Once()
+
+	f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+	assert.NoError(t, f.Flush(context.Background()))
+}
+
+func TestFrontend_GetVariant(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (*httpcache.Frontend, func(language string) httpcache.HTTPLoader, *atomic.Int32) {
+		t.Helper()
+
+		calls := new(atomic.Int32)
+		loaderFor := func(language string) httpcache.HTTPLoader {
+			return func(_ context.Context) (httpcache.Entry, error) {
+				calls.Add(1)
+
+				return httpcache.Entry{
+					Meta:   httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)},
+					Header: map[string][]string{"Vary": {"Accept-Language"}},
+					Body:   []byte(language),
+				}, nil
+			}
+		}
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+
+		return f, loaderFor, calls
+	}
+
+	get := func(t *testing.T, f *httpcache.Frontend, loader httpcache.HTTPLoader, language string) string {
+		t.Helper()
+
+		entry, err := f.GetVariant(t.Context(), testKey, http.Header{"Accept-Language": {language}}, loader)
+		require.NoError(t, err)
+
+		return string(entry.Body)
+	}
+
+	t.Run("variants are stored per selecting header", func(t *testing.T) {
+		t.Parallel()
+
+		f, loaderFor, calls := setup(t)
+
+		for range 2 {
+			for _, language := range []string{"de", "en"} {
+				assert.Equal(t, language, get(t, f, loaderFor(language), language))
+			}
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("purge removes all variants", func(t *testing.T) {
+		t.Parallel()
+
+		f, loaderFor, calls := setup(t)
+
+		_ = get(t, f, loaderFor("de"), "de")
+		_ = get(t, f, loaderFor("en"), "en")
+
+		require.NoError(t, f.Purge(t.Context(), testKey))
+
+		_ = get(t, f, loaderFor("de"), "de")
+		_ = get(t, f, loaderFor("en"), "en")
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("concurrent variants are all purged", func(t *testing.T) {
+		t.Parallel()
+
+		backend := slowGetBackend{MemoryBackend: createInMemoryBackend().(*httpcache.MemoryBackend), delay: 20 * time.Millisecond}
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+		_, loaderFor, calls := setup(t)
+
+		languages := []string{"de", "en", "fr", "it", "nl", "pl"}
+
+		var wg sync.WaitGroup
+
+		for _, language := range languages {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := f.GetVariant(t.Context(), testKey, http.Header{"Accept-Language": {language}}, loaderFor(language))
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+		require.NoError(t, f.Purge(t.Context(), testKey))
+
+		for _, language := range languages {
+			_ = get(t, f, loaderFor(language), language)
+		}
+
+		assert.Equal(t, int32(2*len(languages)), calls.Load(), "every variant is loaded again")
+	})
+
+	t.Run("negative cached variants are removed on purge", func(t *testing.T) {
+		t.Parallel()
+
+		f, loaderFor, _ := setup(t)
+		f.SetNegativeCache(time.Minute, 10)
+
+		failing := func(context.Context) (httpcache.Entry, error) { return httpcache.Entry{}, errors.New("failed") }
+
+		_ = get(t, f, loaderFor("en"), "en")
+		_, err := f.GetVariant(t.Context(), testKey, http.Header{"Accept-Language": {"de"}}, failing)
+		require.Error(t, err)
+
+		require.NoError(t, f.Purge(t.Context(), testKey))
+
+		_ = get(t, f, loaderFor("en"), "en")
+		assert.Equal(t, "de", get(t, f, loaderFor("de"), "de"))
+	})
+
+	t.Run("coalesced loads of other variants are loaded again", func(t *testing.T) {
+		t.Parallel()
+
+		f, loaderFor, _ := setup(t)
+
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		results := make([]string, 2)
+
+		for i, language := range []string{"de", "en"} {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				loader := func(ctx context.Context) (httpcache.Entry, error) {
+					<-release
+
+					return loaderFor(language)(ctx)
+				}
+
+				entry, err := f.GetVariant(t.Context(), testKey, http.Header{"Accept-Language": {language}}, loader)
+				assert.NoError(t, err)
+
+				results[i] = string(entry.Body)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, []string{"de", "en"}, results)
+	})
+}
+
+func TestFrontend_Revalidation(t *testing.T) {
+	t.Parallel()
+
+	expired := httpcache.Entry{
+		Meta: httpcache.Meta{
+			LifeTime:  time.Now().Add(-time.Minute),
+			GraceTime: time.Now().Add(-time.Minute),
+			StaleTime: time.Now().Add(time.Minute),
+			Tags:      []string{"tag"},
+		},
+		Header:     map[string][]string{"Etag": {`"v1"`}, "Content-Length": {"6"}},
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Body:       []byte("stored"),
+	}
+
+	t.Run("not modified entries keep their body", func(t *testing.T) {
+		t.Parallel()
+
+		backend := createInMemoryBackend()
+		require.NoError(t, backend.Set(t.Context(), testKey, expired))
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+		entry, err := f.Get(t.Context(), testKey, func(ctx context.Context) (httpcache.Entry, error) {
+			previous, ok := httpcache.PreviousEntry(ctx)
+			require.True(t, ok)
+			assert.Equal(t, `"v1"`, previous.Header["Etag"][0])
+
+			return httpcache.Entry{
+				Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Hour), Revalidated: true},
+				Header:     map[string][]string{"Etag": {`"v1"`}, "Content-Length": {"0"}, "Date": {"today"}},
+				StatusCode: http.StatusNotModified,
+			}, nil
+		})
+		require.NoError(t, err)
+
+		stored, found, err := backend.Get(t.Context(), testKey)
+		require.NoError(t, err)
+		require.True(t, found)
+
+		for _, got := range []httpcache.Entry{entry, stored} {
+			assert.Equal(t, http.StatusOK, got.StatusCode)
+			assert.Equal(t, []byte("stored"), got.Body)
+			assert.Equal(t, []string{"tag"}, got.Meta.Tags)
+			assert.Equal(t, []string{"6"}, got.Header["Content-Length"])
+			assert.Equal(t, []string{"today"}, got.Header["Date"])
+			assert.True(t, got.Meta.LifeTime.After(time.Now()))
+		}
+	})
+
+	t.Run("not modified without previous entry", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+
+		_, err := f.Get(t.Context(), testKey, func(ctx context.Context) (httpcache.Entry, error) {
+			_, ok := httpcache.PreviousEntry(ctx)
+			assert.False(t, ok)
+
+			return httpcache.Entry{Meta: httpcache.Meta{Revalidated: true}, StatusCode: http.StatusNotModified}, nil
+		})
+		assert.ErrorIs(t, err, httpcache.ErrNotModifiedWithoutEntry)
+	})
+
+	notModified := func(context.Context) (httpcache.Entry, error) {
+		return httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Hour)},
+			Status:     "304 Not Modified",
+			StatusCode: http.StatusNotModified,
+		}, nil
+	}
+
+	t.Run("not modified entries not revalidating are returned without previous entry", func(t *testing.T) {
+		t.Parallel()
+
+		backend := createInMemoryBackend()
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+		entry, err := f.Get(t.Context(), testKey, notModified)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, entry.StatusCode)
+
+		_, found, err := backend.Get(t.Context(), testKey)
+		require.NoError(t, err)
+		assert.False(t, found, "not modified entries are not stored")
+	})
+
+	t.Run("not modified entries not revalidating don't replace the previous entry", func(t *testing.T) {
+		t.Parallel()
+
+		backend := createInMemoryBackend()
+		require.NoError(t, backend.Set(t.Context(), testKey, expired))
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+		entry, err := f.Get(t.Context(), testKey, notModified)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, entry.StatusCode)
+		assert.Empty(t, entry.Body)
+
+		stored, found, err := backend.Get(t.Context(), testKey)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, http.StatusOK, stored.StatusCode)
+		assert.Equal(t, []byte("stored"), stored.Body)
+		assert.False(t, stored.Meta.LifeTime.After(time.Now()), "the meta data is not updated")
+	})
+}
+
+func TestFrontend_GetWithInfo(t *testing.T) {
+	t.Parallel()
+
+	entryWith := func(lifeTime, graceTime time.Duration) httpcache.Entry {
+		return httpcache.Entry{
+			Meta: httpcache.Meta{
+				LifeTime:  time.Now().Add(lifeTime),
+				GraceTime: time.Now().Add(graceTime),
+				CreatedAt: time.Now().Add(-time.Minute),
+			},
+			Body: []byte("stored"),
+		}
+	}
+
+	loader := func(_ context.Context) (httpcache.Entry, error) {
+		return entryWith(time.Minute, time.Minute), nil
+	}
+
+	failingLoader := func(_ context.Context) (httpcache.Entry, error) {
+		return httpcache.Entry{}, errors.New("upstream down")
+	}
+
+	tests := []struct {
+		name        string
+		stored      *httpcache.Entry
+		loader      httpcache.HTTPLoader
+		wantStatus  httpcache.CacheStatus
+		wantBackend string
+		wantAged    bool
+	}{
+		{
+			name:       "miss",
+			loader:     loader,
+			wantStatus: httpcache.CacheStatusMiss,
+			wantAged:   true,
+		},
+		{
+			name:        "hit",
+			stored:      ptr(entryWith(time.Minute, time.Minute)),
+			loader:      loader,
+			wantStatus:  httpcache.CacheStatusHit,
+			wantBackend: "memory",
+			wantAged:    true,
+		},
+		{
+			name:        "stale",
+			stored:      ptr(entryWith(-time.Minute, time.Minute)),
+			loader:      loader,
+			wantStatus:  httpcache.CacheStatusStale,
+			wantBackend: "memory",
+			wantAged:    true,
+		},
+		{
+			name: "error stale",
+			stored: func() *httpcache.Entry {
+				entry := entryWith(-time.Minute, -time.Minute)
+				entry.Meta.StaleTime = time.Now().Add(time.Minute)
+
+				return &entry
+			}(),
+			loader:      failingLoader,
+			wantStatus:  httpcache.CacheStatusErrorStale,
+			wantBackend: "memory",
+			wantAged:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := createInMemoryBackend()
+			if tt.stored != nil {
+				require.NoError(t, backend.Set(t.Context(), testKey, *tt.stored))
+			}
+
+			f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+			_, info, err := f.GetWithInfo(t.Context(), testKey, tt.loader)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, info.Status)
+			assert.Equal(t, tt.wantBackend, info.Backend)
+			assert.Equal(t, tt.wantAged, info.Age >= time.Minute, "age %v", info.Age)
+		})
+	}
+
+	t.Run("coalesced", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+
+		release := make(chan struct{})
+		blockingLoader := func(ctx context.Context) (httpcache.Entry, error) {
+			<-release
+
+			return loader(ctx)
+		}
+
+		var wg sync.WaitGroup
+
+		statuses := make(chan httpcache.CacheStatus, 2)
+
+		for range 2 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, info, err := f.GetWithInfo(t.Context(), testKey, blockingLoader)
+				assert.NoError(t, err)
+
+				statuses <- info.Status
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(statuses)
+
+		var got []httpcache.CacheStatus
+		for status := range statuses {
+			got = append(got, status)
+		}
+
+		assert.ElementsMatch(t, []httpcache.CacheStatus{httpcache.CacheStatusMiss, httpcache.CacheStatusCoalesced}, got)
+	})
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestFrontend_CacheabilityPolicy(t *testing.T) {
+	t.Parallel()
+
+	load := func(t *testing.T, statusCode int) (httpcache.Entry, httpcache.CacheInfo, bool) {
+		t.Helper()
+
+		backend := createInMemoryBackend()
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).
+			SetContextBackend(backend).
+			SetCacheabilityPolicy(httpcache.DefaultCacheabilityPolicy{})
+
+		entry, info, err := f.GetWithInfo(t.Context(), testKey, func(context.Context) (httpcache.Entry, error) {
+			return createEntry(t, "10m", "15m", nil, nil, http.StatusText(statusCode), statusCode, "body"), nil
+		})
+		require.NoError(t, err)
+
+		_, found, err := backend.Get(t.Context(), testKey)
+		require.NoError(t, err)
+
+		return entry, info, found
+	}
+
+	t.Run("cacheable entry is stored", func(t *testing.T) {
+		t.Parallel()
+
+		entry, info, found := load(t, http.StatusOK)
+		assert.Equal(t, "body", string(entry.Body))
+		assert.True(t, info.Stored)
+		assert.True(t, found)
+	})
+
+	t.Run("uncacheable entry is returned but not stored", func(t *testing.T) {
+		t.Parallel()
+
+		entry, info, found := load(t, http.StatusInternalServerError)
+		assert.Equal(t, http.StatusInternalServerError, entry.StatusCode)
+		assert.Equal(t, "body", string(entry.Body))
+		assert.Equal(t, httpcache.CacheStatusMiss, info.Status)
+		assert.False(t, info.Stored)
+		assert.False(t, found)
+	})
+}
+
+func TestFrontend_NoStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("entry is returned without storing, caching the error or serving stale", func(t *testing.T) {
+		t.Parallel()
+
+		backend := createInMemoryBackend()
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend).
+			SetNegativeCache(time.Minute, 10).SetStaleIfError(time.Hour)
+
+		stale := createEntry(t, "-20m", "-10m", nil, nil, "200 OK", http.StatusOK, "stale")
+		require.NoError(t, backend.Set(t.Context(), testKey, stale))
+
+		for range 2 {
+			entry, info, err := f.GetWithInfo(t.Context(), testKey, func(context.Context) (httpcache.Entry, error) {
+				entry := createEntry(t, "10m", "15m", nil, nil, "200 OK", http.StatusOK, "private")
+				entry.Meta.NoStore = true
+
+				return entry, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "private", string(entry.Body))
+			assert.Equal(t, httpcache.CacheStatusMiss, info.Status)
+			assert.False(t, info.Stored)
+		}
+
+		stored, found, err := backend.Get(t.Context(), testKey)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "stale", string(stored.Body))
+	})
+
+	t.Run("expired entries are returned without storing", func(t *testing.T) {
+		t.Parallel()
+
+		// the mock fails on Set
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(httpcache.Entry{}, false, nil)
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+		entry, info, err := f.GetWithInfo(t.Context(), testKey, func(context.Context) (httpcache.Entry, error) {
+			return createEntry(t, "0s", "0s", nil, nil, "200 OK", http.StatusOK, "max-age=0"), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "max-age=0", string(entry.Body))
+		assert.False(t, info.Stored)
+	})
+
+	t.Run("entries expiring while stored are a skipped write", func(t *testing.T) {
+		t.Parallel()
+
+		backend := new(mocks.ContextBackend)
+		backend.EXPECT().Get(mock.Anything, testKey).Return(httpcache.Entry{}, false, nil)
+		backend.EXPECT().Set(mock.Anything, testKey, mock.Anything).Return(&httpcache.ExpiredEntryError{Key: testKey})
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+		entry, info, err := f.GetWithInfo(t.Context(), testKey, func(context.Context) (httpcache.Entry, error) {
+			return createEntry(t, "10m", "15m", nil, nil, "200 OK", http.StatusOK, "expired"), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "expired", string(entry.Body))
+		assert.False(t, info.Stored)
+	})
+
+	t.Run("coalesced callers load their own entry", func(t *testing.T) {
+		t.Parallel()
+
+		f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+
+		calls := new(atomic.Int32)
+		release := make(chan struct{})
+		loader := func(context.Context) (httpcache.Entry, error) {
+			call := calls.Add(1)
+			if call == 1 {
+				<-release
+			}
+
+			entry := createEntry(t, "10m", "15m", nil, nil, "200 OK", http.StatusOK, "caller "+strconv.Itoa(int(call)))
+			entry.Meta.NoStore = true
+
+			return entry, nil
+		}
+
+		var (
+			wg     sync.WaitGroup
+			bodies sync.Map
+		)
+
+		for caller := range 2 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				entry, err := f.Get(t.Context(), testKey, loader)
+				assert.NoError(t, err)
+				bodies.Store(caller, string(entry.Body))
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		close(release)
+		wg.Wait()
+
+		first, _ := bodies.Load(0)
+		second, _ := bodies.Load(1)
+		assert.Equal(t, "caller 1", first)
+		assert.Equal(t, "caller 2", second)
+	})
+}
+
+func TestFrontend_HeaderFilter(t *testing.T) {
+	t.Parallel()
+
+	backend := createInMemoryBackend()
+	f := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+
+	header := map[string][]string{"Content-Type": {"text/plain"}, "Set-Cookie": {"session=1"}, "Connection": {"close"}}
+
+	entry, err := f.Get(t.Context(), testKey, func(context.Context) (httpcache.Entry, error) {
+		return createEntry(t, "10m", "15m", nil, header, "200 OK", http.StatusOK, "body"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, header, entry.Header, "the caller gets the loaded headers")
+
+	stored, found, err := backend.Get(t.Context(), testKey)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, map[string][]string{"Content-Type": {"text/plain"}}, stored.Header)
+}
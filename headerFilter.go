@@ -0,0 +1,86 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+type (
+	// HeaderFilter removes headers of loaded entries before they are stored, so a shared backend does not hand out
+	// headers meant for a single user or connection. Hop-by-hop headers (see RFC 9111 section 3.1) are always removed,
+	// the Vary header is always kept.
+	HeaderFilter struct {
+		// Allow lists the only headers which are stored, all headers are stored if empty
+		Allow []string
+		// Deny lists headers which are never stored, e.g. Set-Cookie
+		Deny []string
+	}
+)
+
+var (
+	// hopByHopHeaders are meaningful for a single connection only
+	hopByHopHeaders = []string{
+		"Connection",
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Proxy-Authentication-Info",
+		"Proxy-Authorization",
+		"Proxy-Connection",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+
+	// defaultHeaderFilter is used by frontends without a header filter
+	defaultHeaderFilter = HeaderFilter{Deny: []string{"Set-Cookie"}}
+)
+
+// Filter returns a copy of the header without the removed headers
+func (h HeaderFilter) Filter(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	removed := make(map[string]bool, len(hopByHopHeaders)+len(h.Deny))
+
+	for _, name := range hopByHopHeaders {
+		removed[name] = true
+	}
+
+	for _, name := range h.Deny {
+		removed[http.CanonicalHeaderKey(name)] = true
+	}
+
+	// headers listed in the Connection header are hop-by-hop as well
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				removed[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+
+	var allowed map[string]bool
+
+	if len(h.Allow) > 0 {
+		allowed = map[string]bool{"Vary": true}
+
+		for _, name := range h.Allow {
+			allowed[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	filtered := make(http.Header, len(header))
+
+	for name, values := range header {
+		canonical := http.CanonicalHeaderKey(name)
+		if canonical != "Vary" && (removed[canonical] || allowed != nil && !allowed[canonical]) {
+			continue
+		}
+
+		filtered[name] = append([]string(nil), values...)
+	}
+
+	return filtered
+}
@@ -0,0 +1,74 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flamingo.me/httpcache"
+)
+
+func TestHeaderFilter_Filter(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{
+		"Cache-Control":     {"max-age=60"},
+		"Connection":        {"close, X-Connection-Only"},
+		"Content-Type":      {"text/plain"},
+		"Set-Cookie":        {"session=1"},
+		"Transfer-Encoding": {"chunked"},
+		"Vary":              {"Accept-Language"},
+		"X-Connection-Only": {"1"},
+		"X-User":            {"me"},
+	}
+
+	tests := []struct {
+		name   string
+		filter httpcache.HeaderFilter
+		want   http.Header
+	}{
+		{
+			name:   "hop-by-hop headers are removed",
+			filter: httpcache.HeaderFilter{},
+			want: http.Header{
+				"Cache-Control": {"max-age=60"},
+				"Content-Type":  {"text/plain"},
+				"Set-Cookie":    {"session=1"},
+				"Vary":          {"Accept-Language"},
+				"X-User":        {"me"},
+			},
+		},
+		{
+			name:   "denied headers are removed",
+			filter: httpcache.HeaderFilter{Deny: []string{"set-cookie", "X-User"}},
+			want: http.Header{
+				"Cache-Control": {"max-age=60"},
+				"Content-Type":  {"text/plain"},
+				"Vary":          {"Accept-Language"},
+			},
+		},
+		{
+			name:   "only allowed headers and vary are kept",
+			filter: httpcache.HeaderFilter{Allow: []string{"content-type", "Transfer-Encoding"}},
+			want: http.Header{
+				"Content-Type": {"text/plain"},
+				"Vary":         {"Accept-Language"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.filter.Filter(header))
+		})
+	}
+
+	t.Run("nil header", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, httpcache.HeaderFilter{}.Filter(nil))
+	})
+}
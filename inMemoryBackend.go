@@ -1,7 +1,10 @@
 package httpcache
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
@@ -15,11 +18,17 @@ type (
 		cacheMetrics Metrics
 		pool         *lru.TwoQueueCache[string, inMemoryCacheEntry]
 		lurkerPeriod time.Duration
+		compressor   *bodyCompressor
+		// variants of the keys, the mutex makes their updates atomic
+		variantsMu sync.Mutex
+		variants   map[string]memoryVariants
 	}
 
 	// MemoryBackendConfig config
 	MemoryBackendConfig struct {
 		Size int
+		// Compression of the stored bodies, disabled if nil
+		Compression *CompressionConfig
 	}
 
 	// InMemoryBackendFactory factory
@@ -33,9 +42,20 @@ type (
 		valid time.Time
 		data  interface{}
 	}
+
+	// memoryVariants are the variant keys of a key, kept as long as the longest living variant
+	memoryVariants struct {
+		valid time.Time
+		keys  []string
+	}
 )
 
-var _ Backend = new(MemoryBackend)
+var (
+	_ ContextBackend         = new(MemoryBackend)
+	_ ContextTagSupporting   = new(MemoryBackend)
+	_ ContextTagCounting     = new(MemoryBackend)
+	_ ContextVariantIndexing = new(MemoryBackend)
+)
 
 // SetConfig for factory
 func (f *InMemoryBackendFactory) SetConfig(config MemoryBackendConfig) *InMemoryBackendFactory {
@@ -56,8 +76,14 @@ func (f *InMemoryBackendFactory) SetFrontendName(frontendName string) *InMemoryB
 }
 
 // Build the instance
-func (f *InMemoryBackendFactory) Build() (Backend, error) {
+func (f *InMemoryBackendFactory) Build() (ContextBackend, error) {
 	cache, _ := lru.New2Q[string, inMemoryCacheEntry](f.config.Size)
+	cacheMetrics := NewCacheMetrics("memory", f.frontendName)
+
+	compressor, err := newBodyCompressor(f.config.Compression, cacheMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMemoryConfig, err)
+	}
 
 	lurkerPeriod := defaultLurkerPeriod
 	if f.lurkerPeriod > 0 {
@@ -66,8 +92,9 @@ func (f *InMemoryBackendFactory) Build() (Backend, error) {
 
 	memoryBackend := &MemoryBackend{
 		pool:         cache,
-		cacheMetrics: NewCacheMetrics("memory", f.frontendName),
+		cacheMetrics: cacheMetrics,
 		lurkerPeriod: lurkerPeriod,
+		compressor:   compressor,
 	}
 
 	go memoryBackend.lurker()
@@ -88,47 +115,142 @@ func (m *MemoryBackend) SetSize(size int) error {
 }
 
 // Get tries to get an object from cache
-func (m *MemoryBackend) Get(key string) (Entry, bool) {
+func (m *MemoryBackend) Get(ctx context.Context, key string) (Entry, bool, error) {
 	entry, found := m.pool.Get(key)
 	if !found {
 		m.cacheMetrics.countMiss()
-		return Entry{}, false
+		return Entry{}, false, nil
 	}
 
 	m.cacheMetrics.countHit()
 
 	data, ok := entry.data.(Entry)
 	if !ok {
-		return Entry{}, false
+		return Entry{}, false, nil
 	}
 
-	return data, true
+	data, err := entryForContext(ctx, data)
+	if err != nil {
+		m.cacheMetrics.countError("DecompressFailed")
+
+		return Entry{}, false, fmt.Errorf("memory backend: %w", err)
+	}
+
+	ReportServingBackend(ctx, "memory")
+
+	return data, true, nil
 }
 
 // Set a cache entry with a key
-func (m *MemoryBackend) Set(key string, entry Entry) error {
+func (m *MemoryBackend) Set(_ context.Context, key string, entry Entry) error {
+	entry, err := m.compressor.compressEntry(entry)
+	if err != nil {
+		m.cacheMetrics.countError("CompressFailed")
+
+		return fmt.Errorf("memory backend: %w", err)
+	}
+
 	m.pool.Add(key, inMemoryCacheEntry{
 		data:  entry,
-		valid: entry.Meta.GraceTime,
+		valid: entry.Meta.KeepUntil(),
 	})
 
 	return nil
 }
 
 // Purge a cache key
-func (m *MemoryBackend) Purge(key string) error {
+func (m *MemoryBackend) Purge(_ context.Context, key string) error {
 	m.pool.Remove(key)
 
 	return nil
 }
 
 // Flush purges all entries in the cache
-func (m *MemoryBackend) Flush() error {
+func (m *MemoryBackend) Flush(_ context.Context) error {
 	m.pool.Purge()
 
+	m.variantsMu.Lock()
+	clear(m.variants)
+	m.variantsMu.Unlock()
+
+	return nil
+}
+
+// AddVariant adds the variant key to the variants of the key
+func (m *MemoryBackend) AddVariant(_ context.Context, key string, variant string, keepUntil time.Time) error {
+	m.variantsMu.Lock()
+	defer m.variantsMu.Unlock()
+
+	if m.variants == nil {
+		m.variants = make(map[string]memoryVariants)
+	}
+
+	variants := m.variants[key]
+	if variants.valid.Before(time.Now()) {
+		variants = memoryVariants{}
+	}
+
+	if !slices.Contains(variants.keys, variant) {
+		variants.keys = append(variants.keys, variant)
+	}
+
+	if keepUntil.After(variants.valid) {
+		variants.valid = keepUntil
+	}
+
+	m.variants[key] = variants
+
 	return nil
 }
 
+// RemoveVariants removes the variants of the key and returns them
+func (m *MemoryBackend) RemoveVariants(_ context.Context, key string) ([]string, error) {
+	m.variantsMu.Lock()
+	defer m.variantsMu.Unlock()
+
+	variants := m.variants[key]
+	delete(m.variants, key)
+
+	return variants.keys, nil
+}
+
+// PurgeTags removes all entries carrying one of the tags, which requires a scan of all entries
+func (m *MemoryBackend) PurgeTags(ctx context.Context, tags []string) error {
+	_, err := m.PurgeTagsWithCount(ctx, tags)
+
+	return err
+}
+
+// PurgeTagsWithCount removes all entries carrying one of the tags and returns the number of removed entries
+func (m *MemoryBackend) PurgeTagsWithCount(_ context.Context, tags []string) (int, error) {
+	purged := 0
+
+	for _, key := range m.pool.Keys() {
+		entry, found := m.pool.Peek(key)
+		if !found {
+			continue
+		}
+
+		data, ok := entry.data.(Entry)
+		if ok && hasAnyTag(data.Meta.Tags, tags) {
+			m.pool.Remove(key)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func hasAnyTag(entryTags []string, tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(entryTags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (m *MemoryBackend) lurker() {
 	for range time.Tick(m.lurkerPeriod) {
 		m.cacheMetrics.recordEntries(int64(m.pool.Len()))
@@ -140,5 +262,18 @@ func (m *MemoryBackend) lurker() {
 				break
 			}
 		}
+
+		m.removeExpiredVariants()
+	}
+}
+
+func (m *MemoryBackend) removeExpiredVariants() {
+	m.variantsMu.Lock()
+	defer m.variantsMu.Unlock()
+
+	for key, variants := range m.variants {
+		if variants.valid.Before(time.Now()) {
+			delete(m.variants, key)
+		}
 	}
 }
@@ -2,6 +2,8 @@ package httpcache
 
 import (
 	"flamingo.me/dingo"
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"flamingo.me/flamingo/v3/framework/web"
 )
 
 //go:generate go run github.com/vektra/mockery/v3@v3.5.5
@@ -9,16 +11,24 @@ import (
 type (
 	// Module basic struct
 	Module struct {
-		frontendFactory *FrontendFactory
+		frontendFactory       *FrontendFactory
+		responseCacheFrontend string
 	}
 )
 
 // Inject dependencies
 func (m *Module) Inject(
 	frontendFactory *FrontendFactory,
+	cfg *struct {
+		ResponseCacheFrontend string `inject:"config:httpcache.responseCache.frontend,optional"`
+	},
 ) *Module {
 	m.frontendFactory = frontendFactory
 
+	if cfg != nil {
+		m.responseCacheFrontend = cfg.ResponseCacheFrontend
+	}
+
 	return m
 }
 
@@ -28,6 +38,12 @@ func (m *Module) Configure(injector *dingo.Injector) {
 	if err != nil {
 		panic(err)
 	}
+
+	flamingo.BindEventSubscriber(injector).ToInstance(m.frontendFactory)
+
+	if m.responseCacheFrontend != "" {
+		injector.BindMulti(new(web.Filter)).To(new(ResponseCacheFilter))
+	}
 }
 
 // CueConfig definition
@@ -39,21 +55,41 @@ httpcache: {
 	Redis :: {
 		backendType: "redis"
 		redis: {
-			host:               string | *"localhost"
-			port:               string | *"6379"
-			username?:          string & !=""
-			password?:          string & !=""
-			tls?:               bool
-			database?:          number
-			idleTimeOutSeconds: int | float | *60
-			maxIdle:            int | float | *8
+			host:                          string | *"localhost"
+			port:                          string | *"6379"
+			username?:                     string & !=""
+			password?:                     string & !=""
+			tls?:                          bool
+			database?:                     number
+			idleTimeOutSeconds:            int | float | *60
+			maxIdle:                       int | float | *8
+			codec:                         "gob" | "binary" | "json" | "msgpack" | *"gob"
+			namespace?:                    string & !=""
+			keyEncoding:                   "escaped" | "legacy" | *"escaped"
+			purgeLegacyKeys:               bool | *false
+			tagCompactionIntervalSeconds?: int | float
+			compression?:                  Compression
+			encryption?: {
+				key:         string & !=""
+				decryptKeys: [...string]
+			}
+			cluster?: {
+				nodes: [...string & !=""]
+			}
+			sentinel?: {
+				addresses:  [...string & !=""]
+				masterName: string & !=""
+				username?:  string & !=""
+				password?:  string & !=""
+			}
 		}
 	}
 
 	Memory :: {
 		backendType: "memory"
 		memory: {
-			size: int | float | *200
+			size:         int | float | *200
+			compression?: Compression
 		}
 	}
 
@@ -65,10 +101,66 @@ httpcache: {
 		}
 	}
 
+	Frontend :: {
+		staleIfErrorSeconds?: int | float
+		refresh?: {
+			concurrency:    int | float | *10
+			queueSize:      int | float | *100
+			dropPolicy:     "newest" | "oldest" | *"newest"
+			timeoutSeconds: int | float | *10
+		}
+		refreshAhead?: {
+			strategy: "xfetch" | "ratio"
+			beta:     int | float | *1
+			ratio:    int | float | *0.8
+		}
+		negativeCache?: {
+			ttlSeconds: int | float
+			size:       int | float | *1000
+		}
+		cacheability?: {
+			statusCodes:      [...int]
+			maxBodySize:      int | float | *0
+			forbiddenHeaders: [...string] | *["Set-Cookie"]
+		}
+		headerFilter?: {
+			allow: [...string]
+			deny:  [...string] | *["Set-Cookie"]
+		}
+	}
+
+	Compression :: {
+		algorithm: "gzip" | "zstd"
+		minSize:   int | float | *1024
+		level:     int | float | *0
+	}
+
 	Cache :: Redis | Memory | Twolevel
 
+	ConfiguredCache :: {
+		Cache
+		frontend?: Frontend
+	}
+
+	ResponseCacheRoute :: {
+		path:             string
+		lifeTimeSeconds:  int | float | *300
+		graceTimeSeconds: int | float | *300
+		tags:             [...string]
+		keyQueryParams:   [...string]
+		ignoreQuery:      bool | *false
+		keyHeaders:       [...string]
+		cacheSessions:    bool | *false
+	}
+
 	frontendFactory: {
-		[string]: Cache
+		[string]: ConfiguredCache
+	}
+
+	responseCache?: {
+		frontend:          string
+		routes:            [...ResponseCacheRoute]
+		cacheStatusHeader: bool | *false
 	}
 }
 `
@@ -0,0 +1,84 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const defaultNegativeCacheSize = 1000
+
+type (
+	// NegativeCacheError is returned for a key whose loader failed recently, it wraps the cached loader error
+	NegativeCacheError struct {
+		Key string
+		Err error
+	}
+
+	// negativeCache remembers loader errors per key for a short time
+	negativeCache struct {
+		errors *expirable.LRU[string, error]
+	}
+)
+
+var _ error = new(NegativeCacheError)
+
+func (e *NegativeCacheError) Error() string {
+	return fmt.Sprintf("cached loader error for key %q: %v", e.Key, e.Err)
+}
+
+func (e *NegativeCacheError) Unwrap() error {
+	return e.Err
+}
+
+func newNegativeCache(ttl time.Duration, size int) *negativeCache {
+	if size <= 0 {
+		size = defaultNegativeCacheSize
+	}
+
+	return &negativeCache{
+		errors: expirable.NewLRU[string, error](size, nil, ttl),
+	}
+}
+
+// get the NegativeCacheError of the key, nil if no loader error is cached
+func (n *negativeCache) get(key string) *NegativeCacheError {
+	err, found := n.errors.Get(key)
+	if !found {
+		return nil
+	}
+
+	return &NegativeCacheError{Key: key, Err: err}
+}
+
+// add the loader error of the key, errors caused by the context of a single caller are not cached
+func (n *negativeCache) add(key string, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	n.errors.Add(key, err)
+}
+
+func (n *negativeCache) remove(key string) {
+	n.errors.Remove(key)
+}
+
+// removeVariants removes the errors of all variants of the key, including variants not known to the variant index
+func (n *negativeCache) removeVariants(key string) {
+	prefix := variantKey(key, nil, nil) + "|"
+
+	for _, cached := range n.errors.Keys() {
+		if strings.HasPrefix(cached, prefix) {
+			n.errors.Remove(cached)
+		}
+	}
+}
+
+func (n *negativeCache) purge() {
+	n.errors.Purge()
+}
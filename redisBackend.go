@@ -1,12 +1,14 @@
 package httpcache
 
 import (
-	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
@@ -19,8 +21,20 @@ type (
 	// RedisBackend implements the cache backend interface with a redis solution
 	RedisBackend struct {
 		cacheMetrics Metrics
-		pool         *redis.Pool
+		topology     redisTopology
 		logger       flamingo.Logger
+		codec        Codec
+		// decoders of all known formats, so entries stored with another codec are still decoded
+		decoders   map[byte]Codec
+		compressor *bodyCompressor
+		cipher     *entryCipher
+		// namespace prefixes all keys of the backend including the separator, it is empty without namespace
+		namespace       string
+		legacyKeys      bool
+		purgeLegacyKeys bool
+		// stopCompactor stops the tag compaction, it is closed by Close
+		stopCompactor chan struct{}
+		closeOnce     sync.Once
 	}
 
 	// RedisBackendFactory creates fully configured instances of Redis
@@ -29,6 +43,7 @@ type (
 		frontendName string
 		pool         *redis.Pool
 		config       *RedisBackendConfig
+		codec        Codec
 	}
 
 	// RedisBackendConfig holds the configuration values
@@ -41,30 +56,111 @@ type (
 		Password           string
 		Database           int
 		TLS                bool
+		// Codec encoding the entries, one of "gob" (default), "binary", "json" or "msgpack"
+		Codec string
+		// Compression of the stored bodies, disabled if nil
+		Compression *CompressionConfig
+		// Encryption of the stored entries, disabled if nil
+		Encryption *EncryptionConfig
+		// Namespace prefixing all keys, so frontends sharing a redis can be flushed separately. Defaults to the frontend name.
+		// It is escaped like the keys and not used by the legacy key encoding.
+		Namespace string
+		// KeyEncoding of the keys, either "escaped" (default) or "legacy", the keys of former releases without namespace,
+		// which map distinct keys to the same redis key
+		KeyEncoding string
+		// PurgeLegacyKeys purges the keys of the legacy encoding as well, so instances still using it don't serve purged entries
+		PurgeLegacyKeys bool
+		// TagCompactionIntervalSeconds is the interval of the compaction of the tag sets, see RedisBackend.CompactTags. Disabled if 0.
+		TagCompactionIntervalSeconds int
+		// Cluster connects to a redis cluster instead of the single redis at Host and Port, disabled if nil
+		Cluster *RedisClusterConfig
+		// Sentinel discovers the redis master with sentinels instead of using the one at Host and Port, disabled if nil
+		Sentinel *RedisSentinelConfig
+	}
+
+	// ExpiredEntryError is returned by RedisBackend.Set and UpdateMeta for entries which are not to be kept anymore,
+	// since their GraceTime and StaleTime are in the past
+	ExpiredEntryError struct {
+		Key       string
+		KeepUntil time.Time
 	}
 )
 
 const (
-	tagPrefix   = "tag:"
-	valuePrefix = "value:"
+	tagPrefix      = "tag:"
+	valuePrefix    = "value:"
+	variantsPrefix = "variants:"
+
+	namespaceSeparator = ":"
+	// flushBatchSize is the number of keys scanned at once by Flush and CompactTags
+	flushBatchSize = 1000
+
+	// entries are stored as hash, so the meta data can be updated without the body
+	metaField = "meta"
+	bodyField = "body"
+	// encodingField holds the content coding of a compressed body
+	encodingField = "encoding"
+	// tagsField holds the keys of the tag sets containing the entry
+	tagsField = "tags"
 )
 
 var (
-	_ Backend            = new(RedisBackend)
-	_ healthcheck.Status = new(RedisBackend)
+	_ ContextBackend         = new(RedisBackend)
+	_ ContextTagSupporting   = new(RedisBackend)
+	_ ContextTagCounting     = new(RedisBackend)
+	_ ContextMetaUpdating    = new(RedisBackend)
+	_ healthcheck.Status     = new(RedisBackend)
+	_ ContextVariantIndexing = new(RedisBackend)
+	_ Closing                = new(RedisBackend)
+	_ error                  = new(ExpiredEntryError)
+
+	// updateMetaScript replaces the meta and tags fields only if the entry including its body is still stored
+	// and adds it to the tag sets KEYS[2..n], whose TTL is extended like in addTagScript
+	updateMetaScript = redis.NewScript(-1, `
+local exists = redis.pcall('HEXISTS', KEYS[1], ARGV[1])
+if type(exists) ~= 'number' or exists == 0 then
+	return 0
+end
+local ttl = tonumber(ARGV[4])
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+if ARGV[6] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[5])
+else
+	redis.call('HSET', KEYS[1], ARGV[5], ARGV[6])
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if redis.call('PTTL', KEYS[i]) < ttl then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+	end
+end
+return 1
+`)
 
 	redisKeyRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
 
 	ErrInvalidRedisConfig = errors.New("invalid redis config")
 	ErrEmptyRedisConfig   = errors.New("empty redis config")
+
+	// ErrEntryExpired is wrapped by ExpiredEntryError
+	ErrEntryExpired = errors.New("entry expired")
 )
 
 func init() {
 	gob.Register(Entry{})
 }
 
+func (e *ExpiredEntryError) Error() string {
+	return fmt.Sprintf("entry for key %q expired at %v", e.Key, e.KeepUntil)
+}
+
+func (e *ExpiredEntryError) Unwrap() error {
+	return ErrEntryExpired
+}
+
 func finalizer(b *RedisBackend) {
-	b.close()
+	_ = b.Close()
 }
 
 // Inject Redis dependencies
@@ -74,7 +170,7 @@ func (f *RedisBackendFactory) Inject(logger flamingo.Logger) *RedisBackendFactor
 }
 
 // Build a new redis backend
-func (f *RedisBackendFactory) Build() (Backend, error) {
+func (f *RedisBackendFactory) Build() (ContextBackend, error) {
 	if f.config == nil {
 		return nil, ErrEmptyRedisConfig
 	}
@@ -83,14 +179,24 @@ func (f *RedisBackendFactory) Build() (Backend, error) {
 		return nil, fmt.Errorf("IdleTimeOut must be >0: %w", ErrInvalidRedisConfig)
 	}
 
-	if f.config.Host == "" || f.config.Port == "" {
+	if f.config.Cluster == nil && f.config.Sentinel == nil && (f.config.Host == "" || f.config.Port == "") {
 		return nil, fmt.Errorf("host and port must set: %w", ErrInvalidRedisConfig)
 	}
 
-	options := []redis.DialOption{
-		redis.DialDatabase(f.config.Database),
+	if f.config.Cluster != nil && f.config.Sentinel != nil {
+		return nil, fmt.Errorf("cluster and sentinel can not be used together: %w", ErrInvalidRedisConfig)
+	}
+
+	if f.config.Cluster != nil && len(f.config.Cluster.Nodes) == 0 {
+		return nil, fmt.Errorf("cluster nodes must be set: %w", ErrInvalidRedisConfig)
+	}
+
+	if f.config.Sentinel != nil && (len(f.config.Sentinel.Addresses) == 0 || f.config.Sentinel.MasterName == "") {
+		return nil, fmt.Errorf("sentinel addresses and master name must be set: %w", ErrInvalidRedisConfig)
 	}
 
+	var options []redis.DialOption
+
 	if f.config.Username != "" {
 		options = append(options, redis.DialUsername(f.config.Username))
 	}
@@ -103,43 +209,149 @@ func (f *RedisBackendFactory) Build() (Backend, error) {
 		options = append(options, redis.DialUseTLS(f.config.TLS))
 	}
 
-	host := fmt.Sprintf("%v:%v", f.config.Host, f.config.Port)
-
-	f.pool = &redis.Pool{
-		MaxIdle:     f.config.MaxIdle,
-		IdleTimeout: time.Second * time.Duration(f.config.IdleTimeOutSeconds),
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
+	codec := f.codec
+	if codec == nil {
+		var err error
 
-			if err != nil {
-				return fmt.Errorf("redis PING failed: %w", err)
-			}
+		codec, err = NewCodec(f.config.Codec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRedisConfig, err)
+		}
+	}
 
-			return nil
-		},
-		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", host, options...)
-		},
+	if err := validateCodec(codec); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRedisConfig, err)
 	}
 
-	conn := f.pool.Get()
-	defer conn.Close()
+	cacheMetrics := NewCacheMetrics("redis", f.frontendName)
 
-	_, err := conn.Do("PING")
+	compressor, err := newBodyCompressor(f.config.Compression, cacheMetrics)
 	if err != nil {
-		return nil, fmt.Errorf("%w: initial redis ping failed with: %w", ErrInvalidRedisConfig, err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRedisConfig, err)
+	}
+
+	entryCipher, err := newEntryCipher(f.config.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRedisConfig, err)
+	}
+
+	if f.config.KeyEncoding != "" && f.config.KeyEncoding != KeyEncodingEscaped && f.config.KeyEncoding != KeyEncodingLegacy {
+		return nil, fmt.Errorf("unknown key encoding %q: %w", f.config.KeyEncoding, ErrInvalidRedisConfig)
+	}
+
+	namespace := f.config.Namespace
+	if namespace == "" {
+		namespace = f.frontendName
+	}
+
+	if f.config.KeyEncoding == KeyEncodingLegacy {
+		// the keys of former releases have no namespace
+		namespace = ""
+	}
+
+	if namespace != "" {
+		// the namespace is escaped, so it can't contain the separator and match the keys of another namespace
+		namespace = escapeKey(namespace) + namespaceSeparator
+	}
+
+	newPool := func(address string, options ...redis.DialOption) *redis.Pool {
+		return &redis.Pool{
+			MaxIdle:     f.config.MaxIdle,
+			IdleTimeout: time.Second * time.Duration(f.config.IdleTimeOutSeconds),
+			TestOnBorrow: func(c redis.Conn, t time.Time) error {
+				_, err := c.Do("PING")
+
+				if err != nil {
+					return fmt.Errorf("redis PING failed: %w", err)
+				}
+
+				return nil
+			},
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", address, options...)
+			},
+		}
+	}
+
+	var topology redisTopology
+
+	switch {
+	case f.config.Cluster != nil:
+		// cluster nodes only have the database 0
+		topology, err = newRedisCluster(context.Background(), f.config.Cluster.Nodes, func(address string) *redis.Pool {
+			return newPool(address, options...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: initial redis cluster slots failed with: %w", ErrInvalidRedisConfig, err)
+		}
+	case f.config.Sentinel != nil:
+		topology, err = newRedisSentinel(context.Background(), *f.config.Sentinel, f.dialSentinel, func(address string) *redis.Pool {
+			return newPool(address, append(options, redis.DialDatabase(f.config.Database))...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: initial redis master discovery failed with: %w", ErrInvalidRedisConfig, err)
+		}
+	default:
+		f.pool = newPool(fmt.Sprintf("%v:%v", f.config.Host, f.config.Port), append(options, redis.DialDatabase(f.config.Database))...)
+
+		conn := f.pool.Get()
+		defer conn.Close()
+
+		_, err = conn.Do("PING")
+		if err != nil {
+			return nil, fmt.Errorf("%w: initial redis ping failed with: %w", ErrInvalidRedisConfig, err)
+		}
+
+		topology = &redisNode{pool: f.pool}
 	}
 
 	redisBackend := &RedisBackend{
-		pool:         f.pool,
+		topology:     topology,
 		logger:       f.logger.WithField(flamingo.LogKeyCategory, "Redis"),
-		cacheMetrics: NewCacheMetrics("redis", f.frontendName),
+		cacheMetrics: cacheMetrics,
+		codec:        codec,
+		decoders: map[byte]Codec{
+			formatGob:      GobCodec{},
+			formatBinaryV1: BinaryCodec{},
+			formatJSON:     JSONCodec{},
+			formatMsgpack:  MsgpackCodec{},
+			codec.Format(): codec,
+		},
+		compressor:      compressor,
+		cipher:          entryCipher,
+		namespace:       namespace,
+		legacyKeys:      f.config.KeyEncoding == KeyEncodingLegacy,
+		purgeLegacyKeys: f.config.PurgeLegacyKeys,
+		stopCompactor:   make(chan struct{}),
 	}
 	runtime.SetFinalizer(redisBackend, finalizer) // close all connections on destruction
 
+	if f.config.TagCompactionIntervalSeconds > 0 {
+		go redisBackend.tagCompactor(time.Duration(f.config.TagCompactionIntervalSeconds) * time.Second)
+	}
+
 	return redisBackend, nil
 }
 
+// dialSentinel connects to a sentinel with its credentials
+func (f *RedisBackendFactory) dialSentinel(ctx context.Context, address string) (redis.Conn, error) {
+	var options []redis.DialOption
+
+	if f.config.Sentinel.Username != "" {
+		options = append(options, redis.DialUsername(f.config.Sentinel.Username))
+	}
+
+	if f.config.Sentinel.Password != "" {
+		options = append(options, redis.DialPassword(f.config.Sentinel.Password))
+	}
+
+	if f.config.TLS {
+		options = append(options, redis.DialUseTLS(f.config.TLS))
+	}
+
+	return redis.DialContext(ctx, "tcp", address, options...) //nolint:wrapcheck // wrapped by masterAddress
+}
+
 // SetFrontendName for redis cache metrics
 func (f *RedisBackendFactory) SetFrontendName(frontendName string) *RedisBackendFactory {
 	f.frontendName = frontendName
@@ -152,42 +364,170 @@ func (f *RedisBackendFactory) SetConfig(config RedisBackendConfig) *RedisBackend
 	return f
 }
 
+// SetCodec encoding the entries, overrides the codec of the config
+func (f *RedisBackendFactory) SetCodec(codec Codec) *RedisBackendFactory {
+	f.codec = codec
+	return f
+}
+
 // SetPool directly - use instead of SetConfig if desired
 func (f *RedisBackendFactory) SetPool(pool *redis.Pool) *RedisBackendFactory {
 	f.pool = pool
 	return f
 }
 
-// Close ensures all redis connections are closed
-func (b *RedisBackend) close() {
-	_ = b.pool.Close()
+// Close stops the tag compaction and closes all redis connections, the backend can't be used afterwards
+func (b *RedisBackend) Close() error {
+	var err error
+
+	b.closeOnce.Do(func() {
+		close(b.stopCompactor)
+
+		err = b.topology.close()
+	})
+
+	return err
+}
+
+// withConn calls fn with a connection to the node storing the redis key
+func (b *RedisBackend) withConn(ctx context.Context, redisKey string, fn func(conn redis.Conn) error) error {
+	err := b.topology.withConn(ctx, redisKey, fn)
+	if errors.Is(err, errRedisConnectionFailed) {
+		b.cacheMetrics.countError("ConnectionFailed")
+	}
+
+	return err
 }
 
-// createPrefixedKey creates a redis-compatible key
+// createPrefixedKey creates the redis key of a value or tag in the configured key encoding
 func (b *RedisBackend) createPrefixedKey(key string, prefix string) string {
+	if b.legacyKeys {
+		return b.createLegacyPrefixedKey(key, prefix)
+	}
+
+	return b.namespace + prefix + escapeKey(key)
+}
+
+// createLegacyPrefixedKey creates the redis key of the legacy key encoding, which has no namespace
+func (b *RedisBackend) createLegacyPrefixedKey(key string, prefix string) string {
 	key = redisKeyRegex.ReplaceAllString(key, "-")
 	return fmt.Sprintf("%v%v", prefix, key)
 }
 
+// purgedKeys returns the redis keys to purge for a value or tag, which includes the legacy key while migrating
+func (b *RedisBackend) purgedKeys(key string, prefix string) []string {
+	keys := []string{b.createPrefixedKey(key, prefix)}
+
+	if legacy := b.createLegacyPrefixedKey(key, prefix); b.purgeLegacyKeys && legacy != keys[0] {
+		keys = append(keys, legacy)
+	}
+
+	return keys
+}
+
 // Get a cache key
-func (b *RedisBackend) Get(key string) (entry Entry, found bool) {
-	conn := b.pool.Get()
-	defer func(conn redis.Conn) {
-		_ = conn.Close()
-	}(conn)
+func (b *RedisBackend) Get(ctx context.Context, key string) (Entry, bool, error) {
+	var (
+		entry Entry
+		found bool
+	)
+
+	err := b.withConn(ctx, b.createPrefixedKey(key, valuePrefix), func(conn redis.Conn) error {
+		var err error
+
+		entry, found, err = b.get(ctx, conn, key)
+
+		return err
+	})
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	return entry, found, nil
+}
+
+// get a cache key from the node storing it
+func (b *RedisBackend) get(ctx context.Context, conn redis.Conn, key string) (Entry, bool, error) {
+	redisKey := b.createPrefixedKey(key, valuePrefix)
+
+	values, err := redis.ByteSlices(redis.DoContext(conn, ctx, "HMGET", redisKey, metaField, bodyField, encodingField))
+	if isWrongType(err) {
+		return b.getLegacy(ctx, conn, key)
+	}
+
+	if _, redirected := redirectOf(err); redirected {
+		// the cluster topology changed, the command is repeated on the node now storing the key
+		return Entry{}, false, err
+	}
 
-	reply, err := conn.Do("GET", b.createPrefixedKey(key, valuePrefix))
 	if err != nil {
 		b.cacheMetrics.countError(fmt.Sprintf("%v", err))
 		b.logger.Error(fmt.Sprintf("Error getting key '%v': %v", key, err))
 
-		return Entry{}, false
+		return Entry{}, false, fmt.Errorf("redis HMGET failed: %w", err)
+	}
+
+	if len(values) != 3 || values[0] == nil {
+		b.cacheMetrics.countMiss()
+
+		return Entry{}, false, nil
+	}
+
+	meta, err := b.cipher.open(values[0], sealedField(redisKey, metaField))
+	if err != nil {
+		return b.undecryptable(key, err)
+	}
+
+	body, err := b.cipher.open(values[1], sealedField(redisKey, bodyField))
+	if err != nil {
+		return b.undecryptable(key, err)
+	}
+
+	redisEntry, err := b.decodeEntry(meta)
+	if errors.Is(err, errUndecodableEntry) {
+		return b.undecodable(key, err)
+	}
+
+	if err != nil {
+		b.cacheMetrics.countError("DecodeFailed")
+		b.logger.Error(fmt.Sprintf("Error decoding content of key '%v': %v", key, err))
+
+		return Entry{}, false, err
+	}
+
+	redisEntry.Body = body
+	redisEntry.BodyEncoding = string(values[2])
+
+	redisEntry, err = entryForContext(ctx, redisEntry)
+	if err != nil {
+		b.cacheMetrics.countError("DecompressFailed")
+		b.logger.Error(fmt.Sprintf("Error decompressing body of key '%v': %v", key, err))
+
+		return Entry{}, false, err
+	}
+
+	b.cacheMetrics.countHit()
+	ReportServingBackend(ctx, "redis")
+
+	return redisEntry, true, nil
+}
+
+// getLegacy reads entries stored as single value before entries were stored as hash
+func (b *RedisBackend) getLegacy(ctx context.Context, conn redis.Conn, key string) (Entry, bool, error) {
+	redisKey := b.createPrefixedKey(key, valuePrefix)
+
+	reply, err := redis.DoContext(conn, ctx, "GET", redisKey)
+	if err != nil {
+		b.cacheMetrics.countError(fmt.Sprintf("%v", err))
+		b.logger.Error(fmt.Sprintf("Error getting key '%v': %v", key, err))
+
+		return Entry{}, false, fmt.Errorf("redis GET failed: %w", err)
 	}
 
 	if reply == nil {
 		b.cacheMetrics.countMiss()
 
-		return Entry{}, false
+		return Entry{}, false, nil
 	}
 
 	value, err := redis.Bytes(reply, err)
@@ -195,28 +535,64 @@ func (b *RedisBackend) Get(key string) (entry Entry, found bool) {
 		b.cacheMetrics.countError("ByteConvertFailed")
 		b.logger.Error(fmt.Sprintf("Error convert value to bytes of key '%v': %v", key, err))
 
-		return Entry{}, false
+		return Entry{}, false, fmt.Errorf("redis GET returned unexpected reply: %w", err)
+	}
+
+	// legacy entries were never encrypted, so they are rejected if encryption is enabled
+	value, err = b.cipher.open(value, sealedField(redisKey, ""))
+	if err != nil {
+		return b.undecryptable(key, err)
 	}
 
 	redisEntry, err := b.decodeEntry(value)
+	if errors.Is(err, errUndecodableEntry) {
+		return b.undecodable(key, err)
+	}
+
 	if err != nil {
 		b.cacheMetrics.countError("DecodeFailed")
 		b.logger.Error(fmt.Sprintf("Error decoding content of key '%v': %v", key, err))
 
-		return Entry{}, false
+		return Entry{}, false, err
 	}
 
 	b.cacheMetrics.countHit()
+	ReportServingBackend(ctx, "redis")
 
-	return redisEntry, true
+	return redisEntry, true, nil
 }
 
-// Set a cache key
-func (b *RedisBackend) Set(key string, entry Entry) error {
-	conn := b.pool.Get()
-	defer func(conn redis.Conn) {
-		_ = conn.Close()
-	}(conn)
+// undecodable entries, e.g. written by another release, are treated as miss and replaced by the next Set
+func (b *RedisBackend) undecodable(key string, err error) (Entry, bool, error) {
+	b.cacheMetrics.countMiss()
+	b.logger.Debug(fmt.Sprintf("Ignoring undecodable content of key '%v': %v", key, err))
+
+	return Entry{}, false, nil
+}
+
+// undecryptable entries are treated as miss and replaced by the next Set, e.g. after the key was rotated out
+func (b *RedisBackend) undecryptable(key string, err error) (Entry, bool, error) {
+	b.cacheMetrics.countError("DecryptFailed")
+	b.logger.Warn(fmt.Sprintf("Ignoring entry of key '%v': %v", key, err))
+
+	return Entry{}, false, nil
+}
+
+// Set a cache key. The entry and its tags are stored in a transaction, so entries are never stored without their tags.
+// In a cluster the tags are added after the entry, which is deleted again if that fails. Returns an ExpiredEntryError if the entry is not to be kept anymore.
+func (b *RedisBackend) Set(ctx context.Context, key string, entry Entry) error {
+	ttl, err := expiration(key, entry)
+	if err != nil {
+		return err
+	}
+
+	entry, err = b.compressor.compressEntry(entry)
+	if err != nil {
+		b.cacheMetrics.countError("CompressFailed")
+		b.logger.Error(fmt.Sprintf("Error compressing body for key %q: %v", key, err))
+
+		return err
+	}
 
 	buffer, err := b.encodeEntry(entry)
 	if err != nil {
@@ -226,149 +602,359 @@ func (b *RedisBackend) Set(key string, entry Entry) error {
 		return err
 	}
 
-	err = conn.Send(
-		"SET",
-		b.createPrefixedKey(key, valuePrefix),
-		buffer,
-		"PX",
-		time.Until(entry.Meta.GraceTime).Round(time.Millisecond).Milliseconds(),
-	)
+	redisKey := b.createPrefixedKey(key, valuePrefix)
+
+	meta, err := b.cipher.seal(buffer, sealedField(redisKey, metaField))
 	if err != nil {
-		b.cacheMetrics.countError("SetFailed")
-		b.logger.Error(fmt.Sprintf("Error setting key %q with timeout %v and buffer %v", key, entry.Meta.GraceTime, buffer))
+		b.cacheMetrics.countError("EncryptFailed")
+
+		return err
+	}
+
+	body, err := b.cipher.seal(entry.Body, sealedField(redisKey, bodyField))
+	if err != nil {
+		b.cacheMetrics.countError("EncryptFailed")
+
+		return err
+	}
+
+	fields := []interface{}{redisKey, metaField, meta, bodyField, body}
+	if entry.BodyEncoding != "" {
+		fields = append(fields, encodingField, entry.BodyEncoding)
+	}
 
-		return fmt.Errorf("redis SET PX failed: %w", err)
+	if tags := b.tagsFieldValue(entry.Meta.Tags); tags != "" {
+		fields = append(fields, tagsField, tags)
 	}
 
-	for _, tag := range entry.Meta.Tags {
-		err = conn.Send(
-			"SADD",
-			b.createPrefixedKey(tag, tagPrefix),
-			b.createPrefixedKey(key, valuePrefix),
+	err = b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+		// the key is deleted first, a value stored before entries were stored as hash would fail HSET
+		err := errors.Join(
+			conn.Send("MULTI"),
+			conn.Send("DEL", redisKey),
+			conn.Send("HSET", fields...),
+			conn.Send("PEXPIRE", redisKey, ttl.Milliseconds()),
 		)
-		if err != nil {
-			b.cacheMetrics.countError("SetTagFailed")
-			b.logger.Error(fmt.Sprintf("Error setting tag: %q on key %q", tag, key))
+		if err == nil && b.topology.singleNode() {
+			err = b.sendTags(conn, key, entry.Meta.Tags, ttl)
+		}
 
-			return fmt.Errorf("redis SADD failed: %w", err)
+		if err != nil {
+			return err
 		}
+
+		return execTransaction(ctx, conn)
+	})
+	if err == nil && !b.topology.singleNode() {
+		// the tag sets are stored on other nodes of the cluster, so they are added after the transaction
+		err = b.addTags(ctx, key, entry.Meta.Tags, ttl)
 	}
 
-	err = conn.Flush()
 	if err != nil {
-		return fmt.Errorf("redis flush failed: %w", err)
+		b.cacheMetrics.countError("SetFailed")
+		b.logger.Error(fmt.Sprintf("Error setting key %q with timeout %v: %v", key, entry.Meta.KeepUntil(), err))
+
+		// redis does not roll back transactions, an entry missing some of its tags must not be kept
+		_ = b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+			_, err := redis.DoContext(conn, ctx, "DEL", redisKey)
+
+			return err //nolint:wrapcheck // ignored
+		})
+
+		return fmt.Errorf("redis set failed: %w", err)
 	}
 
 	return nil
 }
 
-// Purge a cache key
-func (b *RedisBackend) Purge(key string) error {
-	conn := b.pool.Get()
-	defer func(conn redis.Conn) {
-		_ = conn.Close()
-	}(conn)
+// UpdateMeta replaces everything but the body of a stored entry and adds it to its tags atomically,
+// in a cluster the tags are added afterwards. Returns an ExpiredEntryError if the entry is not to be kept anymore.
+func (b *RedisBackend) UpdateMeta(ctx context.Context, key string, entry Entry) error {
+	ttl, err := expiration(key, entry)
+	if err != nil {
+		return err
+	}
 
-	_, err := conn.Do("DEL", b.createPrefixedKey(key, valuePrefix))
+	buffer, err := b.encodeEntry(entry)
 	if err != nil {
-		return fmt.Errorf("redis DEL failed: %w", err)
+		b.cacheMetrics.countError("EncodeFailed")
+		b.logger.Error(fmt.Sprintf("Error encoding entry for key: %q", key))
+
+		return err
 	}
 
-	return nil
-}
+	redisKey := b.createPrefixedKey(key, valuePrefix)
 
-// PurgeTags purges all keys+tags by tag(s)
-func (b *RedisBackend) PurgeTags(tags []string) error {
-	conn := b.pool.Get()
-	defer func(conn redis.Conn) {
-		_ = conn.Close()
-	}(conn)
+	meta, err := b.cipher.seal(buffer, sealedField(redisKey, metaField))
+	if err != nil {
+		b.cacheMetrics.countError("EncryptFailed")
 
-	for _, tag := range tags {
-		reply, err := conn.Do("SMEMBERS", b.createPrefixedKey(tag, tagPrefix))
+		return err
+	}
 
-		members, err := redis.Strings(reply, err)
-		if err != nil {
-			b.logger.Error(fmt.Sprintf("Failed SMEMBERS for tag '%v': %v", tag, err))
+	// the tag sets are stored on other nodes of a cluster, so they are added after the script
+	var tagKeys []string
+
+	if b.topology.singleNode() {
+		for _, tag := range entry.Meta.Tags {
+			tagKeys = append(tagKeys, b.createPrefixedKey(tag, tagPrefix))
 		}
+	}
 
-		for _, member := range members {
-			_, err = conn.Do("DEL", member)
-			if err != nil {
-				b.logger.Error(fmt.Sprintf("Failed DEL for key '%v': %v", member, err))
+	args := redis.Args{1 + len(tagKeys), redisKey}.AddFlat(tagKeys).Add(
+		bodyField,
+		metaField,
+		meta,
+		ttl.Milliseconds(),
+		tagsField,
+		b.tagsFieldValue(entry.Meta.Tags),
+	)
 
-				return fmt.Errorf("redis DEL failed for key %q: %w", member, err)
-			}
-		}
+	var updated int
 
-		_, err = conn.Do("DEL", fmt.Sprintf("%v", tag))
-		if err != nil {
-			b.logger.Error(fmt.Sprintf("Failed DEL for key '%v': %v", tag, err))
+	err = b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+		var err error
 
-			return fmt.Errorf("redis DEL failed for key %q: %w", tag, err)
-		}
+		updated, err = redis.Int(updateMetaScript.DoContext(ctx, conn, args...))
+
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err == nil && updated != 0 && !b.topology.singleNode() {
+		err = b.addTags(ctx, key, entry.Meta.Tags, ttl)
 	}
 
-	err := conn.Flush()
 	if err != nil {
-		return fmt.Errorf("redis flush failed: %w", err)
+		b.cacheMetrics.countError("UpdateMetaFailed")
+
+		return fmt.Errorf("redis update meta failed: %w", err)
+	}
+
+	if updated == 0 {
+		return ErrEntryNotFound
 	}
 
 	return nil
 }
 
-// Flush the whole cache
-func (b *RedisBackend) Flush() error {
-	conn := b.pool.Get()
-	defer func(conn redis.Conn) {
-		_ = conn.Close()
-	}(conn)
+// expiration returns the time until the entry has to be kept, which must be at least a millisecond
+func expiration(key string, entry Entry) (time.Duration, error) {
+	ttl := time.Until(entry.Meta.KeepUntil()).Round(time.Millisecond)
+	if ttl <= 0 {
+		return 0, &ExpiredEntryError{Key: key, KeepUntil: entry.Meta.KeepUntil()}
+	}
 
-	err := conn.Send("FLUSHALL")
+	return ttl, nil
+}
+
+// execTransaction executes the commands queued since MULTI and returns the errors of their replies
+func execTransaction(ctx context.Context, conn redis.Conn) error {
+	replies, err := redis.Values(redis.DoContext(conn, ctx, "EXEC"))
 	if err != nil {
-		b.logger.Error(fmt.Sprintf("Failed purge all keys %v", err))
+		return fmt.Errorf("redis EXEC failed: %w", err)
+	}
+
+	return replyErrors(replies)
+}
 
-		return fmt.Errorf("redis FLUSHALL failed: %w", err)
+// flushPipeline sends the pipelined commands and returns the errors of their replies
+func flushPipeline(ctx context.Context, conn redis.Conn) error {
+	replies, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if errors.Is(err, redis.ErrNil) {
+		// nothing was pipelined
+		return nil
 	}
 
-	err = conn.Flush()
 	if err != nil {
 		return fmt.Errorf("redis flush failed: %w", err)
 	}
 
+	return replyErrors(replies)
+}
+
+func replyErrors(replies []interface{}) error {
+	var errs []error
+
+	for _, reply := range replies {
+		if err, ok := reply.(redis.Error); ok {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Purge a cache key
+func (b *RedisBackend) Purge(ctx context.Context, key string) error {
+	for _, redisKey := range b.purgedKeys(key, valuePrefix) {
+		if _, err := b.purgeValue(ctx, redisKey, ""); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (b *RedisBackend) encodeEntry(entry Entry) (*bytes.Buffer, error) {
-	buffer := new(bytes.Buffer)
+// purgeValue deletes the value and removes it from its tag sets except the purged one, which is deleted anyway.
+// Returns the number of deleted values.
+func (b *RedisBackend) purgeValue(ctx context.Context, redisKey string, purgedTagKey string) (int, error) {
+	var (
+		tagKeys []string
+		deleted int
+	)
+
+	err := b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+		var err error
+
+		tagKeys, err = b.storedTagKeys(ctx, conn, redisKey)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = redis.Int(redis.DoContext(conn, ctx, "DEL", redisKey))
+		if err != nil {
+			return fmt.Errorf("redis DEL failed: %w", err)
+		}
 
-	err := gob.NewEncoder(buffer).Encode(entry)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("gob encode failed: %w", err)
+		return 0, err
+	}
+
+	for _, tagKey := range tagKeys {
+		if tagKey == purgedTagKey {
+			continue
+		}
+
+		err = b.withConn(ctx, tagKey, func(conn redis.Conn) error {
+			_, err := redis.DoContext(conn, ctx, "SREM", tagKey, redisKey)
+			if err != nil {
+				return fmt.Errorf("redis SREM failed: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
 	}
 
-	return buffer, nil
+	return deleted, nil
 }
 
-func (b *RedisBackend) decodeEntry(content []byte) (Entry, error) {
-	buffer := bytes.NewBuffer(content)
-	decoder := gob.NewDecoder(buffer)
-	entry := new(Entry)
+// PurgeTags purges all entries carrying one of the tags
+func (b *RedisBackend) PurgeTags(ctx context.Context, tags []string) error {
+	_, err := b.PurgeTagsWithCount(ctx, tags)
+
+	return err
+}
+
+// Flush removes all values and tags of the namespace. The keys are scanned and unlinked in batches,
+// so redis is not blocked and other namespaces sharing the redis are kept.
+func (b *RedisBackend) Flush(ctx context.Context) error {
+	err := b.topology.withEachMaster(ctx, func(conn redis.Conn) error {
+		for _, prefix := range []string{valuePrefix, tagPrefix, variantsPrefix} {
+			err := b.unlinkMatching(ctx, conn, escapeMatchPattern(b.namespace+prefix)+"*")
+			if err != nil {
+				return err
+			}
+		}
 
-	err := decoder.Decode(entry)
+		return nil
+	})
 	if err != nil {
-		return *entry, fmt.Errorf("gob decode failed: %w", err)
+		b.logger.Error(fmt.Sprintf("Failed purge all keys %v", err))
+
+		return err
 	}
 
-	return *entry, nil
+	return nil
 }
 
-// Status checks the health of the used redis instance
-func (b *RedisBackend) Status() (bool, string) {
-	_, err := b.pool.Get().Do("PING")
-	if err != nil {
-		return false, fmt.Sprintf("redis PING failed: %q", err.Error())
+// unlinkMatching unlinks all keys matching the pattern. The keys are unlinked one by one in a pipeline,
+// since the keys of a batch belong to different slots of a cluster.
+func (b *RedisBackend) unlinkMatching(ctx context.Context, conn redis.Conn, pattern string) error {
+	return b.scanMatching(ctx, conn, pattern, func(keys []string) error {
+		for _, key := range keys {
+			if err := conn.Send("UNLINK", key); err != nil {
+				return fmt.Errorf("redis UNLINK failed: %w", err)
+			}
+		}
+
+		return flushPipeline(ctx, conn)
+	})
+}
+
+// scanMatching calls fn with batches of the keys matching the pattern
+func (b *RedisBackend) scanMatching(ctx context.Context, conn redis.Conn, pattern string, fn func(keys []string) error) error {
+	cursor := "0"
+
+	for {
+		values, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", flushBatchSize))
+		if err != nil {
+			return fmt.Errorf("redis SCAN failed: %w", err)
+		}
+
+		var keys []string
+
+		_, err = redis.Scan(values, &cursor, &keys)
+		if err != nil {
+			return fmt.Errorf("redis SCAN returned unexpected reply: %w", err)
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
 	}
+}
 
-	return true, ""
+// escapeMatchPattern escapes the glob characters of redis MATCH patterns
+func escapeMatchPattern(value string) string {
+	var escaped strings.Builder
+
+	for _, char := range value {
+		if strings.ContainsRune(`*?[]\^`, char) {
+			escaped.WriteRune('\\')
+		}
+
+		escaped.WriteRune(char)
+	}
+
+	return escaped.String()
+}
+
+// encodeEntry without its body, which is stored separately
+func (b *RedisBackend) encodeEntry(entry Entry) ([]byte, error) {
+	entry.Body = nil
+	entry.BodyEncoding = ""
+
+	return encodeWithFormat(b.codec, entry)
+}
+
+func (b *RedisBackend) decodeEntry(content []byte) (Entry, error) {
+	return decodeWithFormat(b.decoders, content)
+}
+
+// sealedField is the additional data of an encrypted field, binding it to its key and field
+func sealedField(redisKey string, field string) string {
+	return redisKey + "\x00" + field
+}
+
+// isWrongType reports whether the key holds a value of another type than expected by the command
+func isWrongType(err error) bool {
+	var redisErr redis.Error
+
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "WRONGTYPE")
+}
+
+// Status checks the health of the used redis instance, or of all masters of a cluster.
+// With sentinels the details name the master in use.
+func (b *RedisBackend) Status() (bool, string) {
+	return b.topology.status(context.Background())
 }
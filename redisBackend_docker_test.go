@@ -3,10 +3,19 @@
 package httpcache_test
 
 import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
 	"flamingo.me/flamingo/v3/framework/flamingo"
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"flamingo.me/httpcache"
 )
@@ -32,6 +41,27 @@ func Test_RunDefaultBackendTestCase_RedisBackend(t *testing.T) {
 		testcase.RunTests()
 	})
 
+	for _, codec := range []string{httpcache.CodecBinary, httpcache.CodecJSON, httpcache.CodecMsgpack} {
+		t.Run("codec "+codec, func(t *testing.T) {
+			config := httpcache.RedisBackendConfig{
+				MaxIdle:            8,
+				IdleTimeOutSeconds: 30,
+				Host:               redisHost,
+				Port:               redisPort,
+				Username:           username,
+				Password:           password,
+				Codec:              codec,
+			}
+
+			factory := httpcache.RedisBackendFactory{}
+
+			backend, err := factory.Inject(flamingo.NullLogger{}).SetConfig(config).SetFrontendName("testfrontend").Build()
+			require.NoError(t, err)
+			testcase := NewBackendTestCase(t, backend, false)
+			testcase.RunTests()
+		})
+	}
+
 	t.Run("failure", func(t *testing.T) {
 		config := httpcache.RedisBackendConfig{
 			MaxIdle:            8,
@@ -48,3 +78,728 @@ func Test_RunDefaultBackendTestCase_RedisBackend(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestRedisBackend_StoredFormats(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, codec string) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Codec:              codec,
+		}).SetFrontendName("formats").Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	rawConn := func(t *testing.T) redis.Conn {
+		t.Helper()
+
+		conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	}
+
+	entry := httpcache.Entry{
+		Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)},
+		StatusCode: 200,
+		Body:       []byte("body"),
+	}
+
+	t.Run("entries of another codec are decoded", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, newBackend(t, httpcache.CodecJSON).Set(t.Context(), "formats-json", entry))
+
+		got, found, err := newBackend(t, httpcache.CodecMsgpack).Get(t.Context(), "formats-json")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "body", string(got.Body))
+	})
+
+	t.Run("legacy gob entries without format are decoded", func(t *testing.T) {
+		t.Parallel()
+
+		legacy := entry
+		legacy.Body = nil
+
+		buffer := new(bytes.Buffer)
+		require.NoError(t, gob.NewEncoder(buffer).Encode(legacy))
+
+		_, err := rawConn(t).Do("HSET", "formats:value:formats-legacy", "meta", buffer.Bytes(), "body", "body")
+		require.NoError(t, err)
+
+		got, found, err := newBackend(t, httpcache.CodecBinary).Get(t.Context(), "formats-legacy")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, 200, got.StatusCode)
+		assert.Equal(t, "body", string(got.Body))
+	})
+
+	t.Run("entries of unknown formats are a miss", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := rawConn(t).Do("HSET", "formats:value:formats-unknown", "meta", []byte{0xf0, 1, 2, 3}, "body", "body")
+		require.NoError(t, err)
+
+		_, found, err := newBackend(t, httpcache.CodecBinary).Get(t.Context(), "formats-unknown")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("invalid codec format", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+		}).SetCodec(invalidFormatCodec{}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidCodecFormat)
+	})
+}
+
+type invalidFormatCodec struct {
+	httpcache.GobCodec
+}
+
+func (invalidFormatCodec) Format() byte {
+	return 0x01
+}
+
+func TestRedisBackend_Compression(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, algorithm string) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Compression:        &httpcache.CompressionConfig{Algorithm: algorithm, MinSize: 100},
+		}).SetFrontendName("compression").Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	body := strings.Repeat("compressible body ", 100)
+	entry := httpcache.Entry{
+		Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)},
+		StatusCode: 200,
+		Body:       []byte(body),
+	}
+
+	t.Run("compressed bodies are returned to contexts accepting the encoding", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, newBackend(t, httpcache.CompressionZstd).Set(t.Context(), "compression-accepted", entry))
+
+		got, found, err := newBackend(t, httpcache.CompressionZstd).Get(httpcache.WithAcceptEncoding(t.Context(), "zstd"), "compression-accepted")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, httpcache.CompressionZstd, got.BodyEncoding)
+		assert.Less(t, len(got.Body), len(body))
+	})
+
+	t.Run("bodies are decompressed independent of the configured algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, newBackend(t, httpcache.CompressionZstd).Set(t.Context(), "compression-other", entry))
+
+		got, found, err := newBackend(t, httpcache.CompressionGzip).Get(httpcache.WithAcceptEncoding(t.Context(), "gzip"), "compression-other")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Empty(t, got.BodyEncoding)
+		assert.Equal(t, body, string(got.Body))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Compression:        &httpcache.CompressionConfig{Algorithm: "br"},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrUnknownCompression)
+	})
+}
+
+func TestRedisBackend_Encryption(t *testing.T) {
+	t.Parallel()
+
+	const (
+		oldKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+		newKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	)
+
+	newBackend := func(t *testing.T, encryption *httpcache.EncryptionConfig) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Encryption:         encryption,
+		}).SetFrontendName("encryption").Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	rawConn := func(t *testing.T) redis.Conn {
+		t.Helper()
+
+		conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	}
+
+	entry := httpcache.Entry{
+		Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)},
+		Header:     map[string][]string{"X-Personal": {"secret header"}},
+		StatusCode: 200,
+		Body:       []byte("secret body"),
+	}
+
+	t.Run("entries are stored encrypted", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, &httpcache.EncryptionConfig{Key: newKey})
+		require.NoError(t, backend.Set(t.Context(), "encryption-stored", entry))
+
+		values, err := redis.ByteSlices(rawConn(t).Do("HMGET", "encryption:value:encryption-stored", "meta", "body"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(values[0]), "secret header")
+		assert.NotContains(t, string(values[1]), "secret body")
+
+		got, found, err := backend.Get(t.Context(), "encryption-stored")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, entry.Header, got.Header)
+		assert.Equal(t, "secret body", string(got.Body))
+	})
+
+	t.Run("entries of rotated keys are decrypted", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, newBackend(t, &httpcache.EncryptionConfig{Key: oldKey}).Set(t.Context(), "encryption-rotated", entry))
+
+		got, found, err := newBackend(t, &httpcache.EncryptionConfig{Key: newKey, DecryptKeys: []string{oldKey}}).Get(t.Context(), "encryption-rotated")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "secret body", string(got.Body))
+
+		_, found, err = newBackend(t, &httpcache.EncryptionConfig{Key: newKey}).Get(t.Context(), "encryption-rotated")
+		require.NoError(t, err)
+		assert.False(t, found, "entries of removed keys are a miss")
+	})
+
+	t.Run("unencrypted entries are a miss", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, newBackend(t, nil).Set(t.Context(), "encryption-plain", entry))
+
+		_, found, err := newBackend(t, &httpcache.EncryptionConfig{Key: newKey}).Get(t.Context(), "encryption-plain")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("encrypted entries can not be moved to other keys", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, &httpcache.EncryptionConfig{Key: newKey})
+		require.NoError(t, backend.Set(t.Context(), "encryption-source", entry))
+
+		conn := rawConn(t)
+		values, err := redis.ByteSlices(conn.Do("HMGET", "encryption:value:encryption-source", "meta", "body"))
+		require.NoError(t, err)
+
+		_, err = conn.Do("HSET", "encryption:value:encryption-target", "meta", values[0], "body", values[1])
+		require.NoError(t, err)
+
+		_, found, err := backend.Get(t.Context(), "encryption-target")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Encryption:         &httpcache.EncryptionConfig{Key: "c2hvcnQ="},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidEncryptionKey)
+	})
+}
+
+func TestRedisBackend_Namespace(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, namespace string, frontendName string) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Namespace:          namespace,
+		}).SetFrontendName(frontendName).Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	entry := httpcache.Entry{
+		Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute), Tags: []string{"tag"}},
+		StatusCode: 200,
+		Body:       []byte("body"),
+	}
+
+	flushed := newBackend(t, "", "namespace-flushed")
+	kept := newBackend(t, "namespace*kept", "namespace-flushed")
+	nested := newBackend(t, "namespace-flushed:value", "other")
+
+	require.NoError(t, flushed.Set(t.Context(), "key", entry))
+	require.NoError(t, kept.Set(t.Context(), "key", entry))
+	require.NoError(t, nested.Set(t.Context(), "key", entry))
+
+	_, err = conn.Do("SET", "namespace-flushed-other-application", "value")
+	require.NoError(t, err)
+
+	exists, err := redis.Bool(conn.Do("EXISTS", "namespace-flushed:value:key"))
+	require.NoError(t, err)
+	assert.True(t, exists, "the frontend name is the default namespace")
+
+	require.NoError(t, flushed.Flush(t.Context()))
+
+	_, found, err := flushed.Get(t.Context(), "key")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	exists, err = redis.Bool(conn.Do("EXISTS", "namespace-flushed:tag:tag"))
+	require.NoError(t, err)
+	assert.False(t, exists, "tags of the namespace are flushed")
+
+	_, found, err = kept.Get(t.Context(), "key")
+	require.NoError(t, err)
+	assert.True(t, found, "other namespaces are kept")
+
+	_, found, err = nested.Get(t.Context(), "key")
+	require.NoError(t, err)
+	assert.True(t, found, "namespaces containing the separator are escaped and kept")
+
+	exists, err = redis.Bool(conn.Do("EXISTS", "namespace-flushed-other-application"))
+	require.NoError(t, err)
+	assert.True(t, exists, "keys of other applications are kept")
+}
+
+func TestRedisBackend_KeyEncoding(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, namespace string, keyEncoding string, purgeLegacyKeys bool) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Namespace:          namespace,
+			KeyEncoding:        keyEncoding,
+			PurgeLegacyKeys:    purgeLegacyKeys,
+		}).Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	newEntry := func(body string, tags ...string) httpcache.Entry {
+		return httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute), Tags: tags},
+			StatusCode: 200,
+			Body:       []byte(body),
+		}
+	}
+
+	t.Run("distinct keys are stored separately", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, "keys-escaped", "", false)
+		keys := []string{"a/b", "a-b", "a?b", "a%2Fb", strings.Repeat("long/", 100) + "1", strings.Repeat("long/", 100) + "2"}
+
+		for _, key := range keys {
+			require.NoError(t, backend.Set(t.Context(), key, newEntry(key)))
+		}
+
+		for _, key := range keys {
+			entry, found, err := backend.Get(t.Context(), key)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, key, string(entry.Body))
+		}
+	})
+
+	t.Run("legacy keys are purged while migrating", func(t *testing.T) {
+		t.Parallel()
+
+		legacy := newBackend(t, "keys-migrating", httpcache.KeyEncodingLegacy, false)
+		require.NoError(t, legacy.Set(t.Context(), "a/b", newEntry("legacy")))
+		require.NoError(t, legacy.Set(t.Context(), "c/d", newEntry("legacy", "tag/1")))
+
+		entry, found, err := legacy.Get(t.Context(), "a-b")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "legacy", string(entry.Body), "the legacy encoding maps distinct keys to the same redis key")
+
+		migrating := newBackend(t, "keys-migrating", httpcache.KeyEncodingEscaped, true)
+
+		_, found, err = migrating.Get(t.Context(), "a/b")
+		require.NoError(t, err)
+		assert.False(t, found, "legacy keys are not read")
+
+		require.NoError(t, migrating.Purge(t.Context(), "a/b"))
+		require.NoError(t, migrating.(httpcache.ContextTagSupporting).PurgeTags(t.Context(), []string{"tag/1"}))
+
+		_, found, err = legacy.Get(t.Context(), "a/b")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		_, found, err = legacy.Get(t.Context(), "c/d")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("keys written by former releases are read and purged", func(t *testing.T) {
+		t.Parallel()
+
+		conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		// former releases stored gob encoded entries without namespace and tag sets of the value keys
+		store := func(key string, tag string) {
+			buffer := new(bytes.Buffer)
+			require.NoError(t, gob.NewEncoder(buffer).Encode(newEntry("former", tag)))
+
+			_, err := conn.Do("SET", "value:"+key, buffer.Bytes(), "PX", time.Minute.Milliseconds())
+			require.NoError(t, err)
+			_, err = conn.Do("SADD", "tag:"+tag, "value:"+key)
+			require.NoError(t, err)
+		}
+
+		store("former-1-a", "former-tag-1")
+		store("former-2-a", "former-tag-2")
+
+		legacy := newBackend(t, "keys-former", httpcache.KeyEncodingLegacy, false)
+
+		entry, found, err := legacy.Get(t.Context(), "former/1?a")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "former", string(entry.Body))
+
+		require.NoError(t, legacy.(httpcache.ContextTagSupporting).PurgeTags(t.Context(), []string{"former-tag-1"}))
+
+		exists, err := redis.Bool(conn.Do("EXISTS", "value:former-1-a"))
+		require.NoError(t, err)
+		assert.False(t, exists, "the legacy encoding purges the keys of former releases")
+
+		migrating := newBackend(t, "keys-former", httpcache.KeyEncodingEscaped, true)
+		require.NoError(t, migrating.(httpcache.ContextTagSupporting).PurgeTags(t.Context(), []string{"former-tag-2"}))
+
+		exists, err = redis.Bool(conn.Do("EXISTS", "value:former-2-a"))
+		require.NoError(t, err)
+		assert.False(t, exists, "migrating backends purge the keys of former releases")
+	})
+
+	t.Run("invalid key encoding", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			KeyEncoding:        "base64",
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidRedisConfig)
+	})
+}
+
+func TestRedisBackend_TagIndex(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, namespace string) *httpcache.RedisBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Namespace:          namespace,
+		}).Build()
+		require.NoError(t, err)
+
+		return backend.(*httpcache.RedisBackend)
+	}
+
+	rawConn := func(t *testing.T) redis.Conn {
+		t.Helper()
+
+		conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	}
+
+	newEntry := func(keepFor time.Duration, tags ...string) httpcache.Entry {
+		return httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(keepFor), GraceTime: time.Now().Add(keepFor), Tags: tags},
+			StatusCode: 200,
+			Body:       []byte("body"),
+		}
+	}
+
+	t.Run("tag sets expire with their longest living member", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, "tags-ttl")
+		require.NoError(t, backend.Set(t.Context(), "long", newEntry(time.Hour, "tag")))
+		require.NoError(t, backend.Set(t.Context(), "short", newEntry(time.Minute, "tag")))
+
+		ttl, err := redis.Int64(rawConn(t).Do("PTTL", "tags-ttl:tag:tag"))
+		require.NoError(t, err)
+		assert.Greater(t, ttl, (59 * time.Minute).Milliseconds())
+	})
+
+	t.Run("purged keys are removed from their tag sets", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, "tags-purge")
+		require.NoError(t, backend.Set(t.Context(), "purged", newEntry(time.Minute, "one", "two")))
+		require.NoError(t, backend.Set(t.Context(), "kept", newEntry(time.Minute, "one")))
+
+		require.NoError(t, backend.Purge(t.Context(), "purged"))
+
+		conn := rawConn(t)
+
+		members, err := redis.Strings(conn.Do("SMEMBERS", "tags-purge:tag:one"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tags-purge:value:kept"}, members)
+
+		exists, err := redis.Bool(conn.Do("EXISTS", "tags-purge:tag:two"))
+		require.NoError(t, err)
+		assert.False(t, exists, "empty tag sets are removed")
+	})
+
+	t.Run("tag purges remove the tag sets and the purged keys from other tag sets", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, "tags-purge-tags")
+		require.NoError(t, backend.Set(t.Context(), "one", newEntry(time.Minute, "purged", "other")))
+		require.NoError(t, backend.Set(t.Context(), "two", newEntry(time.Minute, "purged")))
+		require.NoError(t, backend.Set(t.Context(), "kept", newEntry(time.Minute, "other")))
+
+		purged, err := backend.PurgeTagsWithCount(t.Context(), []string{"purged"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, purged)
+
+		conn := rawConn(t)
+
+		exists, err := redis.Bool(conn.Do("EXISTS", "tags-purge-tags:tag:purged"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		members, err := redis.Strings(conn.Do("SMEMBERS", "tags-purge-tags:tag:other"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tags-purge-tags:value:kept"}, members)
+	})
+
+	t.Run("compaction removes keys of expired entries", func(t *testing.T) {
+		t.Parallel()
+
+		backend := newBackend(t, "tags-compaction")
+		require.NoError(t, backend.Set(t.Context(), "expired", newEntry(time.Minute, "tag")))
+		require.NoError(t, backend.Set(t.Context(), "kept", newEntry(time.Minute, "tag")))
+
+		conn := rawConn(t)
+
+		_, err := conn.Do("DEL", "tags-compaction:value:expired")
+		require.NoError(t, err)
+
+		require.NoError(t, backend.CompactTags(t.Context()))
+
+		members, err := redis.Strings(conn.Do("SMEMBERS", "tags-compaction:tag:tag"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tags-compaction:value:kept"}, members)
+	})
+}
+
+func TestRedisBackend_Variants(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T) *httpcache.RedisBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Host:               redisHost,
+			Port:               redisPort,
+			Username:           username,
+			Password:           password,
+			Namespace:          "variants",
+		}).Build()
+		require.NoError(t, err)
+
+		return backend.(*httpcache.RedisBackend)
+	}
+
+	// instances sharing the redis add variants concurrently
+	instances := []*httpcache.RedisBackend{newBackend(t), newBackend(t)}
+
+	var (
+		wg       sync.WaitGroup
+		variants []string
+	)
+
+	for i := range 20 {
+		variant := fmt.Sprintf("key|vary|Accept-Language=%d", i)
+		variants = append(variants, variant)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, instances[i%2].AddVariant(t.Context(), "key", variant, time.Now().Add(time.Minute)))
+		}()
+	}
+
+	wg.Wait()
+
+	removed, err := instances[0].RemoveVariants(t.Context(), "key")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, variants, removed)
+
+	removed, err = instances[1].RemoveVariants(t.Context(), "key")
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestRedisBackend_Close(t *testing.T) {
+	t.Parallel()
+
+	backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+		MaxIdle:                      8,
+		IdleTimeOutSeconds:           30,
+		Host:                         redisHost,
+		Port:                         redisPort,
+		Username:                     username,
+		Password:                     password,
+		Namespace:                    "close",
+		TagCompactionIntervalSeconds: 1,
+	}).Build()
+	require.NoError(t, err)
+
+	alive, _ := backend.(healthcheck.Status).Status()
+	require.True(t, alive)
+
+	closing, ok := backend.(httpcache.Closing)
+	require.True(t, ok)
+	require.NoError(t, closing.Close())
+	require.NoError(t, closing.Close(), "closing twice is a no-op")
+
+	alive, _ = backend.(healthcheck.Status).Status()
+	assert.False(t, alive, "the connections are closed")
+}
+
+func TestRedisBackend_SetTransaction(t *testing.T) {
+	t.Parallel()
+
+	backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+		MaxIdle:            8,
+		IdleTimeOutSeconds: 30,
+		Host:               redisHost,
+		Port:               redisPort,
+		Username:           username,
+		Password:           password,
+		Namespace:          "transaction",
+	}).Build()
+	require.NoError(t, err)
+
+	conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username), redis.DialPassword(password))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	t.Run("expired entries are not stored", func(t *testing.T) {
+		t.Parallel()
+
+		expired := httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(-time.Minute), GraceTime: time.Now().Add(-time.Second)},
+			StatusCode: 200,
+		}
+
+		err := backend.Set(t.Context(), "expired", expired)
+		assert.ErrorIs(t, err, httpcache.ErrEntryExpired)
+
+		var expiredErr *httpcache.ExpiredEntryError
+		require.ErrorAs(t, err, &expiredErr)
+		assert.Equal(t, "expired", expiredErr.Key)
+
+		err = backend.(httpcache.ContextMetaUpdating).UpdateMeta(t.Context(), "expired", expired)
+		assert.ErrorIs(t, err, httpcache.ErrEntryExpired)
+	})
+
+	t.Run("entries are not kept if a tag fails", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := conn.Do("SET", "transaction:tag:broken", "not a set")
+		require.NoError(t, err)
+
+		err = backend.Set(t.Context(), "broken", httpcache.Entry{
+			Meta:       httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute), Tags: []string{"broken"}},
+			StatusCode: 200,
+		})
+		assert.Error(t, err)
+
+		exists, err := redis.Bool(conn.Do("EXISTS", "transaction:value:broken"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
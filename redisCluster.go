@@ -0,0 +1,419 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// clusterSlots is the number of hash slots of a redis cluster
+	clusterSlots = 16384
+	// maxClusterRedirects is the number of MOVED and ASK redirects followed for a single command
+	maxClusterRedirects = 5
+)
+
+var (
+	_ redisTopology = new(redisCluster)
+
+	ErrClusterUnavailable = errors.New("redis cluster unavailable")
+)
+
+type (
+	// RedisClusterConfig of a redis cluster, the host, port and database of the RedisBackendConfig are ignored
+	RedisClusterConfig struct {
+		// Nodes are the addresses ("host:port") of some nodes of the cluster, the others are discovered
+		Nodes []string
+	}
+
+	// redisCluster routes the keys to the master of their hash slot. The slot map is loaded from CLUSTER SLOTS
+	// and refreshed if a node redirects a command with MOVED or is not reachable.
+	redisCluster struct {
+		seeds   []string
+		newPool func(address string) *redis.Pool
+
+		mutex sync.RWMutex
+		// slots holds the address of the master of every slot, it is empty for uncovered slots
+		slots []string
+		pools map[string]*redis.Pool
+
+		refreshGroup singleflight.Group
+	}
+
+	// askingConn precedes every command and transaction with ASKING, so the node importing a slot serves them
+	askingConn struct {
+		redis.ConnWithContext
+		transaction bool
+	}
+
+	// clusterRedirect of a command to another node
+	clusterRedirect struct {
+		ask     bool
+		slot    int
+		address string
+	}
+)
+
+// newRedisCluster loads the slot map from the first reachable seed node
+func newRedisCluster(ctx context.Context, seeds []string, newPool func(address string) *redis.Pool) (*redisCluster, error) {
+	cluster := &redisCluster{
+		seeds:   seeds,
+		newPool: newPool,
+		slots:   make([]string, clusterSlots),
+		pools:   make(map[string]*redis.Pool),
+	}
+
+	if err := cluster.refresh(ctx); err != nil {
+		_ = cluster.close()
+
+		return nil, err
+	}
+
+	return cluster, nil
+}
+
+// withConn calls fn with a connection to the master of the slot of the key and follows redirects by repeating fn,
+// after ASK redirects the command is preceded by ASKING
+func (c *redisCluster) withConn(ctx context.Context, key string, fn func(conn redis.Conn) error) error {
+	slot := keySlot(key)
+	address := c.master(slot)
+	asking := false
+	refreshed := false
+
+	var err error
+
+	for range maxClusterRedirects + 1 {
+		if address == "" {
+			if err := c.refresh(ctx); err != nil {
+				return err
+			}
+
+			refreshed = true
+
+			address = c.master(slot)
+			if address == "" {
+				return fmt.Errorf("%w: slot %d is not served", ErrClusterUnavailable, slot)
+			}
+		}
+
+		err = withPoolConn(ctx, c.pool(address), func(conn redis.Conn) error {
+			if contextConn, ok := conn.(redis.ConnWithContext); ok && asking {
+				return fn(&askingConn{ConnWithContext: contextConn})
+			}
+
+			return fn(conn)
+		})
+
+		if errors.Is(err, errRedisConnectionFailed) && !refreshed {
+			// the master may have failed over, the command was not sent so it is safe to repeat
+			address = ""
+
+			continue
+		}
+
+		redirect, ok := redirectOf(err)
+		if !ok {
+			return err
+		}
+
+		if strings.HasPrefix(redirect.address, ":") {
+			// the node does not know the host of the other node, which is announced on the same host
+			host, _, _ := net.SplitHostPort(address)
+			redirect.address = host + redirect.address
+		}
+
+		asking = redirect.ask
+		address = redirect.address
+
+		if !redirect.ask {
+			c.moved(ctx, redirect)
+		}
+	}
+
+	return fmt.Errorf("too many redirects for key %q: %w", key, err)
+}
+
+// withEachMaster calls fn with a connection to every master
+func (c *redisCluster) withEachMaster(ctx context.Context, fn func(conn redis.Conn) error) error {
+	var errs []error
+
+	for _, address := range c.masters() {
+		errs = append(errs, withPoolConn(ctx, c.pool(address), fn))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *redisCluster) singleNode() bool {
+	return false
+}
+
+func (c *redisCluster) status(ctx context.Context) (bool, string) {
+	for _, address := range c.masters() {
+		if err := withPoolConn(ctx, c.pool(address), ping); err != nil {
+			return false, fmt.Sprintf("redis PING of cluster node %v failed: %q", address, err.Error())
+		}
+	}
+
+	return true, ""
+}
+
+func (c *redisCluster) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var errs []error
+
+	for address, pool := range c.pools {
+		errs = append(errs, pool.Close())
+		delete(c.pools, address)
+	}
+
+	return errors.Join(errs...)
+}
+
+// master returns the address of the master of the slot
+func (c *redisCluster) master(slot int) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.slots[slot]
+}
+
+// masters returns the distinct addresses of all masters
+func (c *redisCluster) masters() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var masters []string
+
+	seen := make(map[string]bool)
+
+	for _, address := range c.slots {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			masters = append(masters, address)
+		}
+	}
+
+	return masters
+}
+
+// pool of the node, it is created on first use
+func (c *redisCluster) pool(address string) *redis.Pool {
+	c.mutex.RLock()
+	pool, found := c.pools[address]
+	c.mutex.RUnlock()
+
+	if found {
+		return pool
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if pool, found := c.pools[address]; found {
+		return pool
+	}
+
+	pool = c.newPool(address)
+	c.pools[address] = pool
+
+	return pool
+}
+
+// moved assigns the slot to its new master and refreshes the slot map, since a resharding moves more slots
+func (c *redisCluster) moved(ctx context.Context, redirect clusterRedirect) {
+	c.mutex.Lock()
+	c.slots[redirect.slot] = redirect.address
+	c.mutex.Unlock()
+
+	_ = c.refresh(ctx)
+}
+
+// refresh the slot map, concurrent refreshes are merged
+func (c *redisCluster) refresh(ctx context.Context) error {
+	_, err, _ := c.refreshGroup.Do("refresh", func() (interface{}, error) {
+		return nil, c.loadSlots(ctx)
+	})
+
+	return err //nolint:wrapcheck // wrapped by loadSlots
+}
+
+// loadSlots from the known masters or the seed nodes
+func (c *redisCluster) loadSlots(ctx context.Context) error {
+	var errs []error
+
+	for _, address := range append(c.masters(), c.seeds...) {
+		slots, err := c.clusterSlots(ctx, address)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		c.mutex.Lock()
+		c.slots = slots
+		c.mutex.Unlock()
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrClusterUnavailable, errors.Join(errs...))
+}
+
+// clusterSlots returns the master address of every slot reported by the node
+func (c *redisCluster) clusterSlots(ctx context.Context, address string) ([]string, error) {
+	var ranges []interface{}
+
+	err := withPoolConn(ctx, c.pool(address), func(conn redis.Conn) error {
+		var err error
+
+		ranges, err = redis.Values(redis.DoContext(conn, ctx, "CLUSTER", "SLOTS"))
+
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis CLUSTER SLOTS failed on %v: %w", address, err)
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("redis CLUSTER SLOTS returned no slots on %v", address)
+	}
+
+	slots := make([]string, clusterSlots)
+
+	for _, slotRange := range ranges {
+		var (
+			start, end int
+			master     []interface{}
+		)
+
+		// every range consists of the first and last slot, the master and its replicas
+		values, err := redis.Values(slotRange, nil)
+		if err == nil {
+			_, err = redis.Scan(values, &start, &end, &master)
+		}
+
+		if err != nil || start < 0 || end >= clusterSlots || len(master) < 2 {
+			return nil, fmt.Errorf("redis CLUSTER SLOTS returned unexpected reply on %v: %v", address, err)
+		}
+
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+
+		if host == "" {
+			// the node does not know its own host, it is the one asked
+			host, _, _ = net.SplitHostPort(address)
+		}
+
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+
+	return slots, nil
+}
+
+func (c *askingConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if err := c.asking(commandName); err != nil {
+		return nil, err
+	}
+
+	return c.ConnWithContext.Do(commandName, args...) //nolint:wrapcheck // transparent wrapper
+}
+
+func (c *askingConn) DoContext(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	if err := c.asking(commandName); err != nil {
+		return nil, err
+	}
+
+	return c.ConnWithContext.DoContext(ctx, commandName, args...) //nolint:wrapcheck // transparent wrapper
+}
+
+func (c *askingConn) Send(commandName string, args ...interface{}) error {
+	if err := c.asking(commandName); err != nil {
+		return err
+	}
+
+	return c.ConnWithContext.Send(commandName, args...) //nolint:wrapcheck // transparent wrapper
+}
+
+// asking sends ASKING before the command, redis keeps it for all commands of a transaction
+func (c *askingConn) asking(commandName string) error {
+	if commandName == "" {
+		return nil
+	}
+
+	if c.transaction {
+		c.transaction = !strings.EqualFold(commandName, "EXEC") && !strings.EqualFold(commandName, "DISCARD")
+
+		return nil
+	}
+
+	c.transaction = strings.EqualFold(commandName, "MULTI")
+
+	if err := c.ConnWithContext.Send("ASKING"); err != nil {
+		return fmt.Errorf("redis ASKING failed: %w", err)
+	}
+
+	return nil
+}
+
+// redirectOf returns the redirect of a MOVED or ASK error, e.g. "MOVED 3999 127.0.0.1:6381"
+func redirectOf(err error) (clusterRedirect, bool) {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return clusterRedirect{}, false
+	}
+
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || fields[0] != "MOVED" && fields[0] != "ASK" {
+		return clusterRedirect{}, false
+	}
+
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return clusterRedirect{}, false
+	}
+
+	return clusterRedirect{ask: fields[0] == "ASK", slot: slot, address: fields[2]}, true
+}
+
+// keySlot returns the hash slot of the key, only the hash tag is hashed if the key contains one,
+// e.g. "{user1000}.following" and "{user1000}.followers" share a slot
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 is the CRC-16/XMODEM checksum used by redis cluster
+func crc16(value string) uint16 {
+	var crc uint16
+
+	for i := range len(value) {
+		crc ^= uint16(value[i]) << 8
+
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
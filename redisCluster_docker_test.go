@@ -0,0 +1,543 @@
+//go:build integration
+
+package httpcache_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+const standInSlots = 16384
+
+type (
+	// clusterStandIn is a local stand-in of a redis cluster. Every node proxies to its own database of the test redis,
+	// serves CLUSTER SLOTS and redirects commands for keys of other nodes with MOVED, or ASK while a slot is migrated.
+	clusterStandIn struct {
+		t         *testing.T
+		addresses []string
+		// firstDatabase of the test redis used by the first node
+		firstDatabase int
+
+		mutex sync.Mutex
+		// owners holds the index of the node serving every slot
+		owners []int
+		// migrating slots are answered with ASK by their owner and served by the importing node after ASKING
+		migrating map[int]int
+	}
+
+	standInConnState struct {
+		asking      bool
+		transaction bool
+		aborted     bool
+	}
+)
+
+// newClusterStandIn starts the nodes using the databases from firstDatabase on, the slots are distributed evenly
+func newClusterStandIn(t *testing.T, nodes int, firstDatabase int) *clusterStandIn {
+	t.Helper()
+
+	standIn := &clusterStandIn{
+		t:             t,
+		firstDatabase: firstDatabase,
+		owners:        make([]int, standInSlots),
+		migrating:     make(map[int]int),
+	}
+
+	for slot := range standInSlots {
+		standIn.owners[slot] = slot * nodes / standInSlots
+	}
+
+	for node := range nodes {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			_ = listener.Close()
+		})
+
+		standIn.addresses = append(standIn.addresses, listener.Addr().String())
+
+		go standIn.accept(listener, node)
+	}
+
+	return standIn
+}
+
+// database of the test redis holding the keys of the node
+func (s *clusterStandIn) database(node int) redis.Conn {
+	s.t.Helper()
+
+	conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username),
+		redis.DialPassword(password), redis.DialDatabase(s.firstDatabase+node))
+	require.NoError(s.t, err)
+
+	return conn
+}
+
+// keys returns the keys stored by the node
+func (s *clusterStandIn) keys(node int) []string {
+	s.t.Helper()
+
+	conn := s.database(node)
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	require.NoError(s.t, err)
+
+	return keys
+}
+
+// moveSlots of a node including their keys to another node, like a resharding
+func (s *clusterStandIn) moveSlots(from int, to int) {
+	s.t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for slot, owner := range s.owners {
+		if owner == from {
+			s.owners[slot] = to
+		}
+	}
+
+	s.moveKeys(from, to, func(string) bool { return true })
+}
+
+// migrateSlot starts the migration of the slot of the key to another master and moves the key there
+func (s *clusterStandIn) migrateSlot(key string) {
+	s.t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slot := standInKeySlot(key)
+	to := slices.IndexFunc(s.owners, func(owner int) bool { return owner != s.owners[slot] })
+	s.migrating[slot] = s.owners[to]
+	s.moveKeys(s.owners[slot], s.owners[to], func(other string) bool { return other == key })
+}
+
+func (s *clusterStandIn) moveKeys(from int, to int, moved func(key string) bool) {
+	s.t.Helper()
+
+	conn := s.database(from)
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	require.NoError(s.t, err)
+
+	for _, key := range keys {
+		if moved(key) {
+			_, err = conn.Do("MOVE", key, s.firstDatabase+to)
+			require.NoError(s.t, err)
+		}
+	}
+}
+
+func (s *clusterStandIn) accept(listener net.Listener, node int) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serve(conn, node)
+	}
+}
+
+func (s *clusterStandIn) serve(conn net.Conn, node int) {
+	defer conn.Close()
+
+	backing, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username),
+		redis.DialPassword(password), redis.DialDatabase(s.firstDatabase+node))
+	if err != nil {
+		return
+	}
+
+	defer backing.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	state := new(standInConnState)
+
+	for {
+		args, err := readStandInCommand(reader)
+		if err != nil {
+			return
+		}
+
+		reply := s.handle(backing, node, state, args)
+
+		writeStandInReply(writer, reply)
+
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *clusterStandIn) handle(backing redis.Conn, node int, state *standInConnState, args []string) interface{} {
+	command := strings.ToUpper(args[0])
+	asking := state.asking
+
+	switch command {
+	case "ASKING":
+		state.asking = true
+
+		return "OK"
+	case "CLUSTER":
+		if len(args) == 2 && strings.EqualFold(args[1], "SLOTS") {
+			return s.clusterSlots()
+		}
+
+		return redis.Error("ERR unknown CLUSTER subcommand")
+	case "SELECT":
+		return redis.Error("ERR SELECT is not allowed in cluster mode")
+	case "MULTI":
+		state.transaction, state.aborted = true, false
+	case "EXEC":
+		state.transaction = false
+
+		if state.aborted {
+			_, _ = backing.Do("DISCARD")
+
+			return redis.Error("EXECABORT Transaction discarded because of previous errors.")
+		}
+	case "DISCARD":
+		state.transaction = false
+	}
+
+	// like redis, ASKING is kept for all commands of a transaction
+	state.asking = asking && state.transaction
+
+	if redirect := s.redirect(node, standInKeys(command, args), asking); redirect != "" {
+		state.aborted = state.transaction
+
+		return redis.Error(redirect)
+	}
+
+	commandArgs := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		commandArgs = append(commandArgs, arg)
+	}
+
+	reply, err := backing.Do(args[0], commandArgs...)
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		return redisErr
+	}
+
+	if err != nil {
+		return redis.Error("ERR " + err.Error())
+	}
+
+	return reply
+}
+
+// redirect returns the error redirecting the command to the node serving the keys, it is empty if the node serves them
+func (s *clusterStandIn) redirect(node int, keys []string, asking bool) string {
+	slot := -1
+
+	for _, key := range keys {
+		keySlot := standInKeySlot(key)
+		if slot >= 0 && keySlot != slot {
+			return "CROSSSLOT Keys in request don't hash to the same slot"
+		}
+
+		slot = keySlot
+	}
+
+	if slot < 0 {
+		return ""
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if importing, migrating := s.migrating[slot]; migrating {
+		if node == importing && asking {
+			return ""
+		}
+
+		if node == s.owners[slot] {
+			return fmt.Sprintf("ASK %d %s", slot, s.addresses[importing])
+		}
+	}
+
+	if node == s.owners[slot] {
+		return ""
+	}
+
+	return fmt.Sprintf("MOVED %d %s", slot, s.addresses[s.owners[slot]])
+}
+
+func (s *clusterStandIn) clusterSlots() []interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ranges []interface{}
+
+	for start := 0; start < standInSlots; {
+		end := start
+		for end+1 < standInSlots && s.owners[end+1] == s.owners[start] {
+			end++
+		}
+
+		host, port, _ := net.SplitHostPort(s.addresses[s.owners[start]])
+		portNumber, _ := strconv.Atoi(port)
+
+		ranges = append(ranges, []interface{}{
+			int64(start),
+			int64(end),
+			[]interface{}{[]byte(host), int64(portNumber), []byte(fmt.Sprintf("node%d", s.owners[start]))},
+		})
+
+		start = end + 1
+	}
+
+	return ranges
+}
+
+// standInKeys returns the keys of the commands used by the backend
+func standInKeys(command string, args []string) []string {
+	switch command {
+	case "EVAL", "EVALSHA":
+		count, _ := strconv.Atoi(args[2])
+
+		return args[3 : 3+count]
+	case "DEL", "UNLINK", "EXISTS":
+		return args[1:]
+	case "PING", "AUTH", "SCAN", "MULTI", "EXEC", "DISCARD", "SCRIPT":
+		return nil
+	}
+
+	return args[1:min(2, len(args))]
+}
+
+// standInKeySlot is the hash slot of the key, hashing only the hash tag if the key contains one
+func standInKeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	var crc uint16
+
+	for i := range len(key) {
+		crc ^= uint16(key[i]) << 8
+
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return int(crc) % standInSlots
+}
+
+func readStandInCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+
+	args := make([]string, count)
+
+	for i := range args {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected argument %q", line)
+		}
+
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(value[:size])
+	}
+
+	return args, nil
+}
+
+func writeStandInReply(writer *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		_, _ = writer.WriteString("$-1\r\n")
+	case redis.Error:
+		_, _ = fmt.Fprintf(writer, "-%s\r\n", reply)
+	case string:
+		_, _ = fmt.Fprintf(writer, "+%s\r\n", reply)
+	case int64:
+		_, _ = fmt.Fprintf(writer, ":%d\r\n", reply)
+	case []byte:
+		_, _ = fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(reply), reply)
+	case []interface{}:
+		_, _ = fmt.Fprintf(writer, "*%d\r\n", len(reply))
+
+		for _, element := range reply {
+			writeStandInReply(writer, element)
+		}
+	default:
+		_, _ = fmt.Fprintf(writer, "-ERR unexpected reply %T\r\n", reply)
+	}
+}
+
+func TestRedisBackend_Cluster(t *testing.T) {
+	t.Parallel()
+
+	standIn := newClusterStandIn(t, 3, 1)
+
+	newBackend := func(t *testing.T, namespace string) httpcache.ContextBackend {
+		t.Helper()
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Namespace:          namespace,
+			Cluster:            &httpcache.RedisClusterConfig{Nodes: []string{"127.0.0.1:1", standIn.addresses[0]}},
+		}).Build()
+		require.NoError(t, err)
+
+		return backend
+	}
+
+	newEntry := func(tags ...string) httpcache.Entry {
+		return httpcache.Entry{
+			Meta: httpcache.Meta{
+				LifeTime:  time.Now().Add(time.Hour),
+				GraceTime: time.Now().Add(time.Hour),
+				Tags:      tags,
+			},
+			Header:     map[string][]string{},
+			StatusCode: 200,
+			Body:       []byte("body"),
+		}
+	}
+
+	t.Run("default backend test case", func(t *testing.T) {
+		NewBackendTestCase(t, newBackend(t, "cluster-default"), false).RunTests()
+	})
+
+	t.Run("values and tag sets are spread over the nodes", func(t *testing.T) {
+		backend := newBackend(t, "cluster-spread")
+
+		for i := range 30 {
+			require.NoError(t, backend.Set(t.Context(), fmt.Sprintf("key%d", i), newEntry(fmt.Sprintf("tag%d", i%3), "all")))
+		}
+
+		for node := range standIn.addresses {
+			assert.NotEmpty(t, standIn.keys(node), "node %d", node)
+		}
+
+		purged, err := backend.(httpcache.ContextTagCounting).PurgeTagsWithCount(t.Context(), []string{"tag1"})
+		require.NoError(t, err)
+		assert.Equal(t, 10, purged)
+
+		_, found, err := backend.Get(t.Context(), "key1")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		purged, err = backend.(httpcache.ContextTagCounting).PurgeTagsWithCount(t.Context(), []string{"all"})
+		require.NoError(t, err)
+		assert.Equal(t, 20, purged)
+
+		require.NoError(t, backend.(*httpcache.RedisBackend).CompactTags(t.Context()))
+
+		for node := range standIn.addresses {
+			for _, key := range standIn.keys(node) {
+				assert.NotContains(t, key, "cluster-spread:", "node %d", node)
+			}
+		}
+	})
+
+	t.Run("redirects", func(t *testing.T) {
+		// the slots move, so this standIn is not shared with other subtests
+		standIn := newClusterStandIn(t, 3, 4)
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Namespace:          "cluster-redirects",
+			Cluster:            &httpcache.RedisClusterConfig{Nodes: standIn.addresses},
+		}).Build()
+		require.NoError(t, err)
+
+		for i := range 10 {
+			require.NoError(t, backend.Set(t.Context(), fmt.Sprintf("key%d", i), newEntry("tag")))
+		}
+
+		standIn.moveSlots(0, 1)
+
+		for i := range 10 {
+			_, found, err := backend.Get(t.Context(), fmt.Sprintf("key%d", i))
+			require.NoError(t, err, "MOVED is followed")
+			assert.True(t, found)
+		}
+
+		alive, _ := backend.(*httpcache.RedisBackend).Status()
+		assert.True(t, alive)
+
+		standIn.migrateSlot("cluster-redirects:value:key3")
+
+		_, found, err := backend.Get(t.Context(), "key3")
+		require.NoError(t, err, "ASK is followed")
+		assert.True(t, found)
+
+		require.NoError(t, backend.Set(t.Context(), "key3", newEntry("tag")))
+		require.NoError(t, backend.Purge(t.Context(), "key3"))
+
+		_, found, err = backend.Get(t.Context(), "key3")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		purged, err := backend.(httpcache.ContextTagCounting).PurgeTagsWithCount(t.Context(), []string{"tag"})
+		require.NoError(t, err)
+		assert.Equal(t, 9, purged)
+	})
+
+	t.Run("unreachable cluster", func(t *testing.T) {
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Cluster:            &httpcache.RedisClusterConfig{Nodes: []string{"127.0.0.1:1"}},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidRedisConfig)
+		assert.ErrorIs(t, err, httpcache.ErrClusterUnavailable)
+
+		_, err = new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Cluster:            &httpcache.RedisClusterConfig{},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidRedisConfig)
+	})
+}
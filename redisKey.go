@@ -0,0 +1,58 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// KeyEncodingEscaped escapes all but alphanumeric characters, "-", "_" and "." of the keys, so distinct keys never share a redis key
+	KeyEncodingEscaped = "escaped"
+	// KeyEncodingLegacy replaces all but alphanumeric characters of the keys with "-", the encoding of former releases
+	KeyEncodingLegacy = "legacy"
+
+	// maxEscapedKeyLength is the length of escaped keys which are shortened to a readable prefix and a hash of the key
+	maxEscapedKeyLength = 256
+	// hashedKeyPrefixLength is the length of the readable prefix of shortened keys
+	hashedKeyPrefixLength = 128
+	// hashedKeySeparator separates the readable prefix of a shortened key from its hash, it is escaped in all other keys
+	hashedKeySeparator = "~"
+)
+
+// escapeKey percent-encodes all bytes of the key but alphanumeric characters, "-", "_" and ".". Long keys are shortened
+// to their escaped prefix and the SHA-256 hash of the whole key, the separator never occurs in escaped keys.
+func escapeKey(key string) string {
+	var escaped strings.Builder
+
+	for i := range len(key) {
+		char := key[i]
+		if isUnescapedKeyChar(char) {
+			escaped.WriteByte(char)
+
+			continue
+		}
+
+		escaped.WriteString(fmt.Sprintf("%%%02X", char))
+	}
+
+	if escaped.Len() <= maxEscapedKeyLength {
+		return escaped.String()
+	}
+
+	prefix := escaped.String()[:hashedKeyPrefixLength]
+	// an escape sequence must not be cut, so the prefix stays readable
+	if index := strings.LastIndexByte(prefix, '%'); index >= len(prefix)-2 {
+		prefix = prefix[:index]
+	}
+
+	hash := sha256.Sum256([]byte(key))
+
+	return prefix + hashedKeySeparator + hex.EncodeToString(hash[:])
+}
+
+func isUnescapedKeyChar(char byte) bool {
+	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9' ||
+		char == '-' || char == '_' || char == '.'
+}
@@ -0,0 +1,266 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	_ redisTopology = new(redisSentinel)
+
+	ErrMasterUnavailable = errors.New("redis master unavailable")
+)
+
+type (
+	// RedisSentinelConfig of the sentinels monitoring the redis master, the host and port of the RedisBackendConfig are ignored
+	RedisSentinelConfig struct {
+		// Addresses ("host:port") of the sentinels
+		Addresses []string
+		// MasterName of the master monitored by the sentinels
+		MasterName string
+		// Username of the sentinels, if they require authentication
+		Username string
+		// Password of the sentinels, if they require authentication
+		Password string
+	}
+
+	// redisSentinel stores all keys on the master announced by the sentinels. The master is discovered when the backend
+	// is built and again if it is not reachable or was demoted to a replica.
+	redisSentinel struct {
+		sentinels    []string
+		masterName   string
+		dialSentinel func(ctx context.Context, address string) (redis.Conn, error)
+		newPool      func(address string) *redis.Pool
+
+		mutex sync.RWMutex
+		// master is the address of the master in use
+		master string
+		pool   *redis.Pool
+
+		discoverGroup singleflight.Group
+	}
+)
+
+// newRedisSentinel discovers the master with the first reachable sentinel
+func newRedisSentinel(
+	ctx context.Context,
+	config RedisSentinelConfig,
+	dialSentinel func(ctx context.Context, address string) (redis.Conn, error),
+	newPool func(address string) *redis.Pool,
+) (*redisSentinel, error) {
+	sentinel := &redisSentinel{
+		sentinels:    append([]string(nil), config.Addresses...),
+		masterName:   config.MasterName,
+		dialSentinel: dialSentinel,
+		newPool:      newPool,
+	}
+
+	if err := sentinel.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	return sentinel, nil
+}
+
+// withConn calls fn with a connection to the master. If the master is not reachable or rejects the command
+// as replica, the master is discovered again and fn is repeated on the new master.
+func (s *redisSentinel) withConn(ctx context.Context, _ string, fn func(conn redis.Conn) error) error {
+	master, pool := s.current()
+
+	err := withPoolConn(ctx, pool, fn)
+	if err == nil || !isMasterFailure(err) {
+		return err
+	}
+
+	if discoverErr := s.discover(ctx); discoverErr != nil {
+		return errors.Join(err, discoverErr)
+	}
+
+	newMaster, pool := s.current()
+	if newMaster == master || !errors.Is(err, errRedisConnectionFailed) && !isReadOnly(err) {
+		// commands which may have been executed are not repeated
+		return err
+	}
+
+	return withPoolConn(ctx, pool, fn)
+}
+
+func (s *redisSentinel) withEachMaster(ctx context.Context, fn func(conn redis.Conn) error) error {
+	return s.withConn(ctx, "", fn)
+}
+
+func (s *redisSentinel) singleNode() bool {
+	return true
+}
+
+func (s *redisSentinel) status(ctx context.Context) (bool, string) {
+	master, pool := s.current()
+
+	if err := withPoolConn(ctx, pool, ping); err != nil {
+		return false, fmt.Sprintf("redis PING of master %v of %q failed: %q", master, s.masterName, err.Error())
+	}
+
+	return true, fmt.Sprintf("redis master %v of %q", master, s.masterName)
+}
+
+func (s *redisSentinel) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pool == nil {
+		return nil
+	}
+
+	return s.pool.Close() //nolint:wrapcheck // closing is best effort
+}
+
+// current returns the master in use and its pool
+func (s *redisSentinel) current() (string, *redis.Pool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.master, s.pool
+}
+
+// discover the master, concurrent discoveries are merged
+func (s *redisSentinel) discover(ctx context.Context) error {
+	_, err, _ := s.discoverGroup.Do("discover", func() (interface{}, error) {
+		return nil, s.discoverMaster(ctx)
+	})
+
+	return err //nolint:wrapcheck // wrapped by discoverMaster
+}
+
+// discoverMaster asks the sentinels for the master until one announces a reachable master,
+// this sentinel is asked first next time
+func (s *redisSentinel) discoverMaster(ctx context.Context) error {
+	s.mutex.RLock()
+	sentinels := append([]string(nil), s.sentinels...)
+	s.mutex.RUnlock()
+
+	var errs []error
+
+	for i, sentinel := range sentinels {
+		master, err := s.masterAddress(ctx, sentinel)
+		if err == nil {
+			err = s.use(ctx, master)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if i > 0 {
+			s.mutex.Lock()
+			s.sentinels = append(append([]string{sentinel}, sentinels[:i]...), sentinels[i+1:]...)
+			s.mutex.Unlock()
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q: %w", ErrMasterUnavailable, s.masterName, errors.Join(errs...))
+}
+
+// masterAddress announced by the sentinel
+func (s *redisSentinel) masterAddress(ctx context.Context, sentinel string) (string, error) {
+	conn, err := s.dialSentinel(ctx, sentinel)
+	if err != nil {
+		return "", fmt.Errorf("redis sentinel %v not reachable: %w", sentinel, err)
+	}
+
+	defer func(conn redis.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	address, err := redis.Strings(redis.DoContext(conn, ctx, "SENTINEL", "get-master-addr-by-name", s.masterName))
+	if errors.Is(err, redis.ErrNil) {
+		return "", fmt.Errorf("redis sentinel %v does not know the master", sentinel)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("redis sentinel %v failed: %w", sentinel, err)
+	}
+
+	if len(address) != 2 {
+		return "", fmt.Errorf("redis sentinel %v returned unexpected master %v", sentinel, address)
+	}
+
+	return net.JoinHostPort(address[0], address[1]), nil
+}
+
+// use the master, it must report the master role since sentinels may announce the old master during a failover
+func (s *redisSentinel) use(ctx context.Context, master string) error {
+	current, currentPool := s.current()
+
+	pool := currentPool
+	if master != current || pool == nil {
+		pool = s.newPool(master)
+	}
+
+	err := withPoolConn(ctx, pool, func(conn redis.Conn) error {
+		role, err := redis.Values(redis.DoContext(conn, ctx, "ROLE"))
+		if err != nil {
+			return fmt.Errorf("redis ROLE failed: %w", err)
+		}
+
+		if len(role) == 0 {
+			return errors.New("redis ROLE returned no role")
+		}
+
+		if name, _ := redis.String(role[0], nil); name != "master" {
+			return fmt.Errorf("redis %v has the role %q", master, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if pool != currentPool {
+			_ = pool.Close()
+		}
+
+		return fmt.Errorf("master %v announced for %q: %w", master, s.masterName, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pool != pool && s.pool != nil {
+		// connections in use are closed when they are returned
+		_ = s.pool.Close()
+	}
+
+	s.master, s.pool = master, pool
+
+	return nil
+}
+
+// isMasterFailure reports whether the error is caused by an unreachable or demoted master.
+// Timeouts are no master failure, discovering a slow master again would only add load.
+func isMasterFailure(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || isReadOnly(err)
+}
+
+// isReadOnly reports whether a replica rejected a write, the command was not executed
+func isReadOnly(err error) bool {
+	var redisErr redis.Error
+
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "READONLY")
+}
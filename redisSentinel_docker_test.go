@@ -0,0 +1,346 @@
+//go:build integration
+
+package httpcache_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+type (
+	// sentinelStandIn is a local stand-in of a sentinel monitoring masters, which proxy to their own databases of the
+	// test redis. Masters which are not announced anymore answer as replica, a failover moves the keys like a replication.
+	sentinelStandIn struct {
+		t             *testing.T
+		masterName    string
+		sentinel      string
+		firstDatabase int
+		masters       []*sentinelStandInMaster
+
+		mutex   sync.Mutex
+		current int
+
+		// delay of the replies of the masters
+		delay atomic.Int64
+	}
+
+	sentinelStandInMaster struct {
+		address  string
+		listener net.Listener
+
+		mutex sync.Mutex
+		conns []net.Conn
+	}
+)
+
+// newSentinelStandIn starts the sentinel and the masters using the databases from firstDatabase on, the first master is announced
+func newSentinelStandIn(t *testing.T, masterName string, masters int, firstDatabase int) *sentinelStandIn {
+	t.Helper()
+
+	standIn := &sentinelStandIn{t: t, masterName: masterName, firstDatabase: firstDatabase}
+
+	sentinel := standIn.listen()
+	standIn.sentinel = sentinel.Addr().String()
+
+	go standIn.accept(sentinel, standIn.serveSentinel)
+
+	for index := range masters {
+		listener := standIn.listen()
+		master := &sentinelStandInMaster{address: listener.Addr().String(), listener: listener}
+		standIn.masters = append(standIn.masters, master)
+
+		go standIn.accept(listener, func(conn net.Conn) {
+			master.mutex.Lock()
+			master.conns = append(master.conns, conn)
+			master.mutex.Unlock()
+
+			standIn.serveMaster(conn, index)
+		})
+	}
+
+	return standIn
+}
+
+func (s *sentinelStandIn) listen() net.Listener {
+	s.t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.t, err)
+
+	s.t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	return listener
+}
+
+func (s *sentinelStandIn) accept(listener net.Listener, serve func(conn net.Conn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go serve(conn)
+	}
+}
+
+// failover to the master, the keys of the former master are moved to it. A stopped former master is not reachable anymore.
+func (s *sentinelStandIn) failover(to int, stop bool) {
+	s.t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username),
+		redis.DialPassword(password), redis.DialDatabase(s.firstDatabase+s.current))
+	require.NoError(s.t, err)
+
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	require.NoError(s.t, err)
+
+	for _, key := range keys {
+		_, err = conn.Do("MOVE", key, s.firstDatabase+to)
+		require.NoError(s.t, err)
+	}
+
+	if stop {
+		master := s.masters[s.current]
+		_ = master.listener.Close()
+
+		master.mutex.Lock()
+		for _, conn := range master.conns {
+			_ = conn.Close()
+		}
+		master.mutex.Unlock()
+	}
+
+	s.current = to
+}
+
+func (s *sentinelStandIn) serveSentinel(conn net.Conn) {
+	s.serve(conn, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			return "PONG"
+		case "SENTINEL":
+			if len(args) != 3 || !strings.EqualFold(args[1], "get-master-addr-by-name") {
+				return redis.Error("ERR unknown SENTINEL subcommand")
+			}
+
+			if args[2] != s.masterName {
+				return nil
+			}
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			host, port, _ := net.SplitHostPort(s.masters[s.current].address)
+
+			return []interface{}{[]byte(host), []byte(port)}
+		}
+
+		return redis.Error("ERR unknown command")
+	})
+}
+
+func (s *sentinelStandIn) serveMaster(conn net.Conn, index int) {
+	backing, err := redis.Dial("tcp", fmt.Sprintf("%s:%s", redisHost, redisPort), redis.DialUsername(username),
+		redis.DialPassword(password), redis.DialDatabase(s.firstDatabase+index))
+	if err != nil {
+		_ = conn.Close()
+
+		return
+	}
+
+	defer backing.Close()
+
+	s.serve(conn, func(args []string) interface{} {
+		time.Sleep(time.Duration(s.delay.Load()))
+
+		s.mutex.Lock()
+		isMaster := s.current == index
+		s.mutex.Unlock()
+
+		command := strings.ToUpper(args[0])
+
+		switch {
+		case command == "ROLE" && isMaster:
+			return []interface{}{[]byte("master"), int64(0), []interface{}{}}
+		case command == "ROLE":
+			host, port, _ := net.SplitHostPort(s.masters[s.current].address)
+
+			return []interface{}{[]byte("slave"), []byte(host), []byte(port), []byte("connected"), int64(0)}
+		case !isMaster && !strings.Contains(" PING AUTH SELECT HMGET HGET GET EXISTS SMEMBERS SCAN ", " "+command+" "):
+			return redis.Error("READONLY You can't write against a read only replica.")
+		}
+
+		commandArgs := make([]interface{}, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			commandArgs = append(commandArgs, arg)
+		}
+
+		reply, err := backing.Do(args[0], commandArgs...)
+
+		var redisErr redis.Error
+		if errors.As(err, &redisErr) {
+			return redisErr
+		}
+
+		if err != nil {
+			return redis.Error("ERR " + err.Error())
+		}
+
+		return reply
+	})
+}
+
+func (s *sentinelStandIn) serve(conn net.Conn, handle func(args []string) interface{}) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		args, err := readStandInCommand(reader)
+		if err != nil {
+			return
+		}
+
+		writeStandInReply(writer, handle(args))
+
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func TestRedisBackend_Sentinel(t *testing.T) {
+	t.Parallel()
+
+	newEntry := func(tags ...string) httpcache.Entry {
+		return httpcache.Entry{
+			Meta: httpcache.Meta{
+				LifeTime:  time.Now().Add(time.Hour),
+				GraceTime: time.Now().Add(time.Hour),
+				Tags:      tags,
+			},
+			Header:     map[string][]string{},
+			StatusCode: 200,
+			Body:       []byte("body"),
+		}
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		t.Parallel()
+
+		standIn := newSentinelStandIn(t, "mymaster", 2, 7)
+
+		redisBackend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Namespace:          "sentinel",
+			Sentinel: &httpcache.RedisSentinelConfig{
+				Addresses:  []string{"127.0.0.1:1", standIn.sentinel},
+				MasterName: "mymaster",
+			},
+		}).Build()
+		require.NoError(t, err)
+
+		backend := redisBackend.(*httpcache.RedisBackend)
+
+		alive, details := backend.Status()
+		assert.True(t, alive)
+		assert.Contains(t, details, standIn.masters[0].address)
+
+		require.NoError(t, backend.Set(t.Context(), "key1", newEntry("tag")))
+
+		standIn.failover(1, false)
+
+		require.NoError(t, backend.Set(t.Context(), "key2", newEntry("tag")), "writes rejected by the former master are repeated")
+
+		alive, details = backend.Status()
+		assert.True(t, alive)
+		assert.Contains(t, details, standIn.masters[1].address)
+
+		standIn.failover(0, true)
+
+		for _, key := range []string{"key1", "key2"} {
+			_, found, err := backend.Get(t.Context(), key)
+			require.NoError(t, err, "the master is discovered if it is not reachable")
+			assert.True(t, found)
+		}
+
+		alive, details = backend.Status()
+		assert.True(t, alive)
+		assert.Contains(t, details, standIn.masters[0].address)
+
+		purged, err := backend.PurgeTagsWithCount(t.Context(), []string{"tag"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, purged)
+	})
+
+	t.Run("timeouts don't discover the master again", func(t *testing.T) {
+		t.Parallel()
+
+		standIn := newSentinelStandIn(t, "mymaster", 1, 10)
+
+		backend, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			MaxIdle:            8,
+			IdleTimeOutSeconds: 30,
+			Namespace:          "sentinel-timeout",
+			Sentinel:           &httpcache.RedisSentinelConfig{Addresses: []string{standIn.sentinel}, MasterName: "mymaster"},
+		}).Build()
+		require.NoError(t, err)
+
+		standIn.delay.Store(int64(500 * time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err = backend.Get(ctx, "key")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NotErrorIs(t, err, httpcache.ErrMasterUnavailable, "a slow master is not discovered again")
+
+		standIn.delay.Store(0)
+
+		_, found, err := backend.Get(t.Context(), "key")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("unknown master", func(t *testing.T) {
+		t.Parallel()
+
+		standIn := newSentinelStandIn(t, "mymaster", 1, 9)
+
+		_, err := new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Sentinel:           &httpcache.RedisSentinelConfig{Addresses: []string{standIn.sentinel}, MasterName: "other"},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidRedisConfig)
+		assert.ErrorIs(t, err, httpcache.ErrMasterUnavailable)
+
+		_, err = new(httpcache.RedisBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.RedisBackendConfig{
+			IdleTimeOutSeconds: 30,
+			Sentinel:           &httpcache.RedisSentinelConfig{Addresses: []string{standIn.sentinel}},
+		}).Build()
+		assert.ErrorIs(t, err, httpcache.ErrInvalidRedisConfig)
+	})
+}
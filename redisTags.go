@@ -0,0 +1,390 @@
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// purgeTagsBatchSize is the number of entries deleted in a pipeline by PurgeTagsWithCount on a single node
+const purgeTagsBatchSize = 500
+
+var (
+	// addTagScript adds a value key to a tag set and extends the TTL of the set to the TTL of the value,
+	// so tag sets expire together with their longest living member
+	addTagScript = redis.NewScript(1, `
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 and redis.call('PTTL', KEYS[1]) < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+	// takeSetScript returns the members of the set KEYS[1] and deletes it, so members added afterwards are kept in a new set
+	takeSetScript = redis.NewScript(1, `
+local members = redis.call('SMEMBERS', KEYS[1])
+redis.call('DEL', KEYS[1])
+return members
+`)
+)
+
+// sendTags adds the key to the sets of its tags
+func (b *RedisBackend) sendTags(conn redis.Conn, key string, tags []string, ttl time.Duration) error {
+	for _, tag := range tags {
+		err := addTagScript.Send(
+			conn,
+			b.createPrefixedKey(tag, tagPrefix),
+			b.createPrefixedKey(key, valuePrefix),
+			ttl.Milliseconds(),
+		)
+		if err != nil {
+			b.cacheMetrics.countError("SetTagFailed")
+			b.logger.Error(fmt.Sprintf("Error setting tag: %q on key %q", tag, key))
+
+			return fmt.Errorf("redis SADD failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addTags adds the key to the sets of its tags one by one, since the sets are stored on other nodes of a cluster
+func (b *RedisBackend) addTags(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	redisKey := b.createPrefixedKey(key, valuePrefix)
+
+	for _, tag := range tags {
+		tagKey := b.createPrefixedKey(tag, tagPrefix)
+
+		err := b.withConn(ctx, tagKey, func(conn redis.Conn) error {
+			_, err := addTagScript.DoContext(ctx, conn, tagKey, redisKey, ttl.Milliseconds())
+
+			return err //nolint:wrapcheck // wrapped below
+		})
+		if err != nil {
+			b.cacheMetrics.countError("SetTagFailed")
+			b.logger.Error(fmt.Sprintf("Error setting tag: %q on key %q", tag, key))
+
+			return fmt.Errorf("redis SADD failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// tagsFieldValue lists the keys of the tag sets of an entry, so they are known when the entry is purged
+func (b *RedisBackend) tagsFieldValue(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, b.createPrefixedKey(tag, tagPrefix))
+	}
+
+	value, _ := json.Marshal(tagKeys)
+
+	return string(value)
+}
+
+// storedTagKeys returns the keys of the tag sets containing the stored value
+func (b *RedisBackend) storedTagKeys(ctx context.Context, conn redis.Conn, redisKey string) ([]string, error) {
+	value, err := redis.Bytes(redis.DoContext(conn, ctx, "HGET", redisKey, tagsField))
+
+	return b.parseTagKeys(redisKey, value, err)
+}
+
+// parseTagKeys parses the reply of HGET of the tags field
+func (b *RedisBackend) parseTagKeys(redisKey string, value []byte, err error) ([]string, error) {
+	if errors.Is(err, redis.ErrNil) || isWrongType(err) {
+		// entries without tags and legacy entries stored as single value
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("redis HGET failed: %w", err)
+	}
+
+	var tagKeys []string
+
+	err = json.Unmarshal(value, &tagKeys)
+	if err != nil {
+		b.logger.Warn(fmt.Sprintf("Ignoring invalid tags of key '%v': %v", redisKey, err))
+
+		return nil, nil
+	}
+
+	return tagKeys, nil
+}
+
+// CompactTags removes the keys of expired or removed entries from the tag sets of the namespace.
+// The sizes of the tag sets are recorded in the metrics.
+func (b *RedisBackend) CompactTags(ctx context.Context) error {
+	var sets int64
+
+	err := b.topology.withEachMaster(ctx, func(conn redis.Conn) error {
+		return b.scanMatching(ctx, conn, escapeMatchPattern(b.namespace+tagPrefix)+"*", func(tagKeys []string) error {
+			for _, tagKey := range tagKeys {
+				size, err := b.compactTagSet(ctx, conn, tagKey)
+				if err != nil {
+					return err
+				}
+
+				sets++
+
+				b.cacheMetrics.recordTagSetSize(size)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		b.cacheMetrics.countError("CompactTagsFailed")
+
+		return err
+	}
+
+	b.cacheMetrics.recordTagSets(sets)
+
+	return nil
+}
+
+// compactTagSet removes the keys which don't exist anymore from the tag set and returns its remaining size
+func (b *RedisBackend) compactTagSet(ctx context.Context, conn redis.Conn, tagKey string) (int64, error) {
+	members, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", tagKey))
+	if err != nil {
+		return 0, fmt.Errorf("redis SMEMBERS failed for tag %q: %w", tagKey, err)
+	}
+
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	exists, err := b.existing(ctx, conn, members)
+	if err != nil {
+		return 0, fmt.Errorf("redis EXISTS failed for members of tag %q: %w", tagKey, err)
+	}
+
+	removed := redis.Args{tagKey}
+
+	for i, member := range members {
+		if exists[i] == 0 {
+			removed = append(removed, member)
+		}
+	}
+
+	if len(removed) == 1 {
+		return int64(len(members)), nil
+	}
+
+	_, err = redis.DoContext(conn, ctx, "SREM", removed...)
+	if err != nil {
+		return 0, fmt.Errorf("redis SREM failed for tag %q: %w", tagKey, err)
+	}
+
+	compacted := int64(len(removed) - 1)
+	b.cacheMetrics.countTagsCompacted(compacted)
+
+	return int64(len(members)) - compacted, nil
+}
+
+// existing returns 1 for every existing key and 0 for the others. The keys are checked in a pipeline on a single node,
+// otherwise one by one on the nodes storing them.
+func (b *RedisBackend) existing(ctx context.Context, conn redis.Conn, keys []string) ([]int, error) {
+	if b.topology.singleNode() {
+		for _, key := range keys {
+			err := conn.Send("EXISTS", key)
+			if err != nil {
+				return nil, fmt.Errorf("redis EXISTS failed: %w", err)
+			}
+		}
+
+		return redis.Ints(redis.DoContext(conn, ctx, "")) //nolint:wrapcheck // wrapped by compactTagSet
+	}
+
+	exists := make([]int, len(keys))
+
+	for i, key := range keys {
+		err := b.withConn(ctx, key, func(conn redis.Conn) error {
+			var err error
+
+			exists[i], err = redis.Int(redis.DoContext(conn, ctx, "EXISTS", key))
+
+			return err //nolint:wrapcheck // wrapped by compactTagSet
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return exists, nil
+}
+
+// tagCompactor compacts the tag sets periodically until the backend is closed
+func (b *RedisBackend) tagCompactor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopCompactor:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+
+		if err := b.CompactTags(ctx); err != nil {
+			b.logger.Error(fmt.Sprintf("Failed to compact tags: %v", err))
+		}
+
+		cancel()
+	}
+}
+
+// PurgeTagsWithCount purges all entries carrying one of the tags together with the tag sets and returns the number
+// of purged entries. The members of a tag set are taken atomically, so entries tagged meanwhile are kept for the next purge.
+// The entries are stored on other nodes than the tag sets in a cluster, so they are deleted and removed from their other
+// tag sets one by one, on a single node in pipelined batches.
+func (b *RedisBackend) PurgeTagsWithCount(ctx context.Context, tags []string) (int, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+
+	var tagKeys []string
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, b.purgedKeys(tag, tagPrefix)...)
+	}
+
+	purged, err := b.purgeTagSets(ctx, tagKeys)
+	if err != nil {
+		b.cacheMetrics.countError("PurgeTagsFailed")
+		b.logger.Error(fmt.Sprintf("Failed purge of tags %v: %v", tags, err))
+
+		return 0, fmt.Errorf("redis purge tags failed: %w", err)
+	}
+
+	b.logger.Debug(fmt.Sprintf("Purged %d entries with tags %v", purged, tags))
+
+	return purged, nil
+}
+
+// purgeTagSets takes the members of the tag sets and purges them
+func (b *RedisBackend) purgeTagSets(ctx context.Context, tagKeys []string) (int, error) {
+	purged := 0
+
+	for _, tagKey := range tagKeys {
+		var members []string
+
+		err := b.withConn(ctx, tagKey, func(conn redis.Conn) error {
+			var err error
+
+			members, err = redis.Strings(takeSetScript.DoContext(ctx, conn, tagKey))
+			if err != nil {
+				return fmt.Errorf("redis SMEMBERS failed for tag %q: %w", tagKey, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+
+		if !b.topology.singleNode() {
+			for _, member := range members {
+				deleted, err := b.purgeValue(ctx, member, tagKey)
+				purged += deleted
+
+				if err != nil {
+					return purged, err
+				}
+			}
+
+			continue
+		}
+
+		for batch := range slices.Chunk(members, purgeTagsBatchSize) {
+			err = b.withConn(ctx, tagKey, func(conn redis.Conn) error {
+				deleted, err := b.purgeValueBatch(ctx, conn, batch, tagKey)
+				purged += deleted
+
+				return err
+			})
+			if err != nil {
+				return purged, err
+			}
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeValueBatch deletes the values of a single node in a pipeline and removes them from their tag sets except the
+// purged one like purgeValue. Returns the number of deleted values.
+func (b *RedisBackend) purgeValueBatch(ctx context.Context, conn redis.Conn, redisKeys []string, purgedTagKey string) (int, error) {
+	for _, redisKey := range redisKeys {
+		if err := conn.Send("HGET", redisKey, tagsField); err != nil {
+			return 0, fmt.Errorf("redis HGET failed: %w", err)
+		}
+	}
+
+	replies, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return 0, fmt.Errorf("redis HGET failed: %w", err)
+	}
+
+	deletes := make([]int, 0, len(redisKeys))
+	sent := 0
+
+	for i, redisKey := range redisKeys {
+		value, err := redis.Bytes(replies[i], nil)
+
+		tagKeys, err := b.parseTagKeys(redisKey, value, err)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := conn.Send("DEL", redisKey); err != nil {
+			return 0, fmt.Errorf("redis DEL failed: %w", err)
+		}
+
+		deletes = append(deletes, sent)
+		sent++
+
+		for _, tagKey := range tagKeys {
+			if tagKey == purgedTagKey {
+				continue
+			}
+
+			if err := conn.Send("SREM", tagKey, redisKey); err != nil {
+				return 0, fmt.Errorf("redis SREM failed: %w", err)
+			}
+
+			sent++
+		}
+	}
+
+	replies, err = redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return 0, fmt.Errorf("redis DEL failed: %w", err)
+	}
+
+	deleted := 0
+
+	for _, i := range deletes {
+		count, err := redis.Int(replies[i], nil)
+		if err != nil {
+			return deleted, fmt.Errorf("redis DEL failed: %w", err)
+		}
+
+		deleted += count
+	}
+
+	return deleted, nil
+}
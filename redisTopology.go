@@ -0,0 +1,84 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type (
+	// redisTopology provides the connections to the redis nodes storing the keys
+	redisTopology interface {
+		// withConn calls fn with a connection to the node storing the key
+		withConn(ctx context.Context, key string, fn func(conn redis.Conn) error) error
+		// withEachMaster calls fn with a connection to every master node, e.g. to scan all keys
+		withEachMaster(ctx context.Context, fn func(conn redis.Conn) error) error
+		// singleNode reports whether all keys are stored on one node, so transactions and scripts may span several keys
+		singleNode() bool
+		// status of the nodes for the health check
+		status(ctx context.Context) (bool, string)
+		close() error
+	}
+
+	// redisNode is a single redis storing all keys
+	redisNode struct {
+		pool *redis.Pool
+	}
+)
+
+var (
+	_ redisTopology = new(redisNode)
+
+	// errRedisConnectionFailed marks errors getting a connection, the command was not sent
+	errRedisConnectionFailed = errors.New("redis connection failed")
+)
+
+func (n *redisNode) withConn(ctx context.Context, _ string, fn func(conn redis.Conn) error) error {
+	return withPoolConn(ctx, n.pool, fn)
+}
+
+func (n *redisNode) withEachMaster(ctx context.Context, fn func(conn redis.Conn) error) error {
+	return withPoolConn(ctx, n.pool, fn)
+}
+
+func (n *redisNode) singleNode() bool {
+	return true
+}
+
+func (n *redisNode) status(ctx context.Context) (bool, string) {
+	err := withPoolConn(ctx, n.pool, ping)
+	if err != nil {
+		return false, fmt.Sprintf("redis PING failed: %q", err.Error())
+	}
+
+	return true, ""
+}
+
+func (n *redisNode) close() error {
+	return n.pool.Close() //nolint:wrapcheck // closing is best effort
+}
+
+// withPoolConn calls fn with a connection of the pool, which is closed afterwards
+func withPoolConn(ctx context.Context, pool *redis.Pool, fn func(conn redis.Conn) error) error {
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRedisConnectionFailed, err)
+	}
+
+	defer func(conn redis.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	return fn(conn)
+}
+
+func ping(conn redis.Conn) error {
+	_, err := conn.Do("PING")
+	if err != nil {
+		return fmt.Errorf("redis PING failed: %w", err)
+	}
+
+	return nil
+}
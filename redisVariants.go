@@ -0,0 +1,51 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// AddVariant adds the variant key to the variant set of the key, which expires together with its longest living member
+func (b *RedisBackend) AddVariant(ctx context.Context, key string, variant string, keepUntil time.Time) error {
+	redisKey := b.createPrefixedKey(key, variantsPrefix)
+
+	err := b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+		_, err := addTagScript.DoContext(ctx, conn, redisKey, variant, time.Until(keepUntil).Milliseconds())
+
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		b.cacheMetrics.countError("AddVariantFailed")
+		b.logger.Error(fmt.Sprintf("Error adding variant of key '%v': %v", key, err))
+
+		return fmt.Errorf("redis SADD failed: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveVariants deletes the variant set of the key and returns its members
+func (b *RedisBackend) RemoveVariants(ctx context.Context, key string) ([]string, error) {
+	redisKey := b.createPrefixedKey(key, variantsPrefix)
+
+	var variants []string
+
+	err := b.withConn(ctx, redisKey, func(conn redis.Conn) error {
+		var err error
+
+		variants, err = redis.Strings(takeSetScript.DoContext(ctx, conn, redisKey))
+
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		b.cacheMetrics.countError("RemoveVariantsFailed")
+		b.logger.Error(fmt.Sprintf("Error removing variants of key '%v': %v", key, err))
+
+		return nil, fmt.Errorf("redis SMEMBERS failed: %w", err)
+	}
+
+	return variants, nil
+}
@@ -0,0 +1,98 @@
+package httpcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// RefreshAheadXFetch selects the XFetchRefreshAhead strategy in RefreshAheadConfig
+	RefreshAheadXFetch = "xfetch"
+	// RefreshAheadRatio selects the LifetimeRatioRefreshAhead strategy in RefreshAheadConfig
+	RefreshAheadRatio = "ratio"
+)
+
+var ErrInvalidRefreshAhead = errors.New("invalid refresh ahead strategy")
+
+type (
+	// RefreshAheadStrategy decides whether a fresh entry is refreshed in background before its LifeTime ends
+	RefreshAheadStrategy interface {
+		ShouldRefresh(entry Entry, now time.Time) bool
+	}
+
+	// XFetchRefreshAhead implements probabilistic early expiration (XFetch): the closer an entry gets to the end of its
+	// LifeTime and the longer it took to load, the more likely a request triggers a refresh.
+	// Frequently requested entries are therefore refreshed before they expire, rarely requested ones are not.
+	XFetchRefreshAhead struct {
+		// Beta scales the probability, values above 1 favor earlier refreshes, defaults to 1
+		Beta float64
+	}
+
+	// LifetimeRatioRefreshAhead refreshes an entry once the given ratio of its lifetime has elapsed
+	LifetimeRatioRefreshAhead struct {
+		// Ratio between 0 and 1, e.g. 0.8 refreshes after 80% of the lifetime
+		Ratio float64
+	}
+
+	// RefreshAheadConfig typed configuration of the refresh ahead strategy
+	RefreshAheadConfig struct {
+		Strategy string
+		Beta     float64
+		Ratio    float64
+	}
+)
+
+var (
+	_ RefreshAheadStrategy = XFetchRefreshAhead{}
+	_ RefreshAheadStrategy = LifetimeRatioRefreshAhead{}
+)
+
+// ShouldRefresh if now plus a random gap, scaled by the load duration of the entry, reaches the end of its LifeTime
+func (x XFetchRefreshAhead) ShouldRefresh(entry Entry, now time.Time) bool {
+	if entry.Meta.LoadDuration <= 0 {
+		return false
+	}
+
+	beta := x.Beta
+	if beta <= 0 {
+		beta = 1
+	}
+
+	// 1-rand is in (0, 1] so the logarithm is finite and not positive
+	gap := time.Duration(float64(entry.Meta.LoadDuration) * beta * -math.Log(1-rand.Float64())) //nolint:gosec // no cryptographic randomness required
+
+	return !now.Add(gap).Before(entry.Meta.LifeTime)
+}
+
+// ShouldRefresh if the ratio of the lifetime between CreatedAt and LifeTime has elapsed
+func (r LifetimeRatioRefreshAhead) ShouldRefresh(entry Entry, now time.Time) bool {
+	if r.Ratio <= 0 || entry.Meta.CreatedAt.IsZero() {
+		return false
+	}
+
+	lifetime := entry.Meta.LifeTime.Sub(entry.Meta.CreatedAt)
+	if lifetime <= 0 {
+		return false
+	}
+
+	return now.Sub(entry.Meta.CreatedAt) >= time.Duration(float64(lifetime)*r.Ratio)
+}
+
+// Build the configured strategy
+func (c RefreshAheadConfig) Build() (RefreshAheadStrategy, error) {
+	switch c.Strategy {
+	case RefreshAheadXFetch:
+		return XFetchRefreshAhead{Beta: c.Beta}, nil
+	case RefreshAheadRatio:
+		if c.Ratio <= 0 || c.Ratio > 1 {
+			return nil, fmt.Errorf("ratio %v must be in (0, 1]: %w", c.Ratio, ErrInvalidRefreshAhead)
+		}
+
+		return LifetimeRatioRefreshAhead{Ratio: c.Ratio}, nil
+	}
+
+	return nil, fmt.Errorf("strategy %q: %w", c.Strategy, ErrInvalidRefreshAhead)
+}
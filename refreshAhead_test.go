@@ -0,0 +1,83 @@
+package httpcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestLifetimeRatioRefreshAhead_ShouldRefresh(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	entry := httpcache.Entry{
+		Meta: httpcache.Meta{
+			CreatedAt: now.Add(-90 * time.Second),
+			LifeTime:  now.Add(10 * time.Second),
+		},
+	}
+
+	assert.True(t, httpcache.LifetimeRatioRefreshAhead{Ratio: 0.8}.ShouldRefresh(entry, now))
+	assert.False(t, httpcache.LifetimeRatioRefreshAhead{Ratio: 0.95}.ShouldRefresh(entry, now))
+	assert.False(t, httpcache.LifetimeRatioRefreshAhead{Ratio: 0.8}.ShouldRefresh(httpcache.Entry{Meta: httpcache.Meta{LifeTime: entry.Meta.LifeTime}}, now), "entries without creation time are not refreshed")
+}
+
+func TestXFetchRefreshAhead_ShouldRefresh(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	t.Run("far from expiry", func(t *testing.T) {
+		t.Parallel()
+
+		entry := httpcache.Entry{Meta: httpcache.Meta{LifeTime: now.Add(time.Hour), LoadDuration: time.Millisecond}}
+
+		for range 100 {
+			assert.False(t, httpcache.XFetchRefreshAhead{Beta: 1}.ShouldRefresh(entry, now))
+		}
+	})
+
+	t.Run("close to expiry with slow loader", func(t *testing.T) {
+		t.Parallel()
+
+		entry := httpcache.Entry{Meta: httpcache.Meta{LifeTime: now.Add(time.Millisecond), LoadDuration: time.Hour}}
+		refreshed := 0
+
+		for range 100 {
+			if (httpcache.XFetchRefreshAhead{Beta: 1}).ShouldRefresh(entry, now) {
+				refreshed++
+			}
+		}
+
+		assert.Greater(t, refreshed, 90)
+	})
+
+	t.Run("unknown load duration", func(t *testing.T) {
+		t.Parallel()
+
+		entry := httpcache.Entry{Meta: httpcache.Meta{LifeTime: now.Add(time.Millisecond)}}
+		assert.False(t, httpcache.XFetchRefreshAhead{Beta: 1}.ShouldRefresh(entry, now))
+	})
+}
+
+func TestRefreshAheadConfig_Build(t *testing.T) {
+	t.Parallel()
+
+	strategy, err := httpcache.RefreshAheadConfig{Strategy: "xfetch", Beta: 2}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, httpcache.XFetchRefreshAhead{Beta: 2}, strategy)
+
+	strategy, err = httpcache.RefreshAheadConfig{Strategy: "ratio", Ratio: 0.8}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, httpcache.LifetimeRatioRefreshAhead{Ratio: 0.8}, strategy)
+
+	_, err = httpcache.RefreshAheadConfig{Strategy: "ratio", Ratio: 1.5}.Build()
+	assert.ErrorIs(t, err, httpcache.ErrInvalidRefreshAhead)
+
+	_, err = httpcache.RefreshAheadConfig{Strategy: "unknown"}.Build()
+	assert.ErrorIs(t, err, httpcache.ErrInvalidRefreshAhead)
+}
@@ -0,0 +1,198 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// RefreshDropNewest drops the refresh to be queued if the queue is full
+	RefreshDropNewest RefreshDropPolicy = "newest"
+	// RefreshDropOldest drops the oldest queued refresh to make room for the new one
+	RefreshDropOldest RefreshDropPolicy = "oldest"
+
+	defaultRefreshConcurrency = 10
+	defaultRefreshQueueSize   = 100
+	defaultRefreshTimeout     = 10 * time.Second
+)
+
+type (
+	// RefreshDropPolicy decides which refresh is dropped if the queue is full
+	RefreshDropPolicy string
+
+	// RefreshConfig of the executor running background refreshes of a Frontend
+	RefreshConfig struct {
+		// Concurrency is the number of refreshes running at the same time, defaults to 10
+		Concurrency int
+		// QueueSize is the number of refreshes waiting for execution, defaults to 100
+		QueueSize int
+		// DropPolicy applied if the queue is full, defaults to RefreshDropNewest
+		DropPolicy RefreshDropPolicy
+		// TimeoutSeconds limits a single refresh, starting when a worker runs it, defaults to 10
+		TimeoutSeconds int
+	}
+
+	// refresher executes background refreshes with a bounded number of workers and a bounded queue
+	refresher struct {
+		mu         sync.Mutex
+		queue      chan refreshTask
+		pending    map[string]struct{}
+		dropPolicy RefreshDropPolicy
+		metrics    Metrics
+		workers    sync.WaitGroup
+		closed     bool
+	}
+
+	refreshTask struct {
+		key string
+		run func()
+	}
+)
+
+// timeout of a single refresh
+func (c RefreshConfig) timeout() time.Duration {
+	if c.TimeoutSeconds <= 0 {
+		return defaultRefreshTimeout
+	}
+
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func newRefresher(config RefreshConfig, metrics Metrics) *refresher {
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultRefreshConcurrency
+	}
+
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultRefreshQueueSize
+	}
+
+	dropPolicy := config.DropPolicy
+	if dropPolicy == "" {
+		dropPolicy = RefreshDropNewest
+	}
+
+	r := &refresher{
+		queue:      make(chan refreshTask, queueSize),
+		pending:    make(map[string]struct{}),
+		dropPolicy: dropPolicy,
+		metrics:    metrics,
+	}
+
+	for range concurrency {
+		r.workers.Add(1)
+
+		go r.work()
+	}
+
+	return r
+}
+
+// submit queues a refresh for the key, a refresh already waiting for the same key is not queued twice.
+// It returns false if the refresh was dropped.
+func (r *refresher) submit(key string, run func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		r.metrics.countRefreshDropped()
+
+		return false
+	}
+
+	if _, found := r.pending[key]; found {
+		return true
+	}
+
+	task := refreshTask{key: key, run: run}
+
+	if !r.enqueue(task) {
+		if r.dropPolicy != RefreshDropOldest {
+			r.metrics.countRefreshDropped()
+
+			return false
+		}
+
+		select {
+		case oldest := <-r.queue:
+			delete(r.pending, oldest.key)
+			r.metrics.countRefreshDropped()
+		default:
+		}
+
+		if !r.enqueue(task) {
+			r.metrics.countRefreshDropped()
+
+			return false
+		}
+	}
+
+	r.pending[key] = struct{}{}
+	r.metrics.countRefreshQueued()
+	r.metrics.recordRefreshQueueLength(int64(len(r.queue)))
+
+	return true
+}
+
+func (r *refresher) enqueue(task refreshTask) bool {
+	select {
+	case r.queue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *refresher) work() {
+	defer r.workers.Done()
+
+	for task := range r.queue {
+		r.mu.Lock()
+		delete(r.pending, task.key)
+		r.mu.Unlock()
+
+		task.run()
+	}
+}
+
+// shutdown stops accepting refreshes, drops the queued ones and waits for the running ones
+func (r *refresher) shutdown(ctx context.Context) error {
+	r.mu.Lock()
+
+	if !r.closed {
+		r.closed = true
+
+	drain:
+		for {
+			select {
+			case <-r.queue:
+				r.metrics.countRefreshDropped()
+			default:
+				break drain
+			}
+		}
+
+		clear(r.pending)
+		close(r.queue)
+	}
+
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("refreshes still running: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,179 @@
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// ResponsePolicy controls how NewEntryFromResponse derives the Meta of an Entry if the response lacks the headers
+	ResponsePolicy struct {
+		// DefaultLifeTime is used if the response has neither Cache-Control max-age/s-maxage nor Expires
+		DefaultLifeTime time.Duration
+		// DefaultGraceTime beyond the LifeTime is used if the response has no Cache-Control stale-while-revalidate
+		DefaultGraceTime time.Duration
+	}
+
+	cacheControl map[string]string
+)
+
+// NewEntryFromResponse reads and closes the body of the response and creates an Entry of it.
+//
+// The LifeTime is derived from Cache-Control s-maxage or max-age, or from Expires, reduced by the Age of the response.
+// Cache-Control no-store, no-cache and private make the entry stale immediately without a default grace time.
+// The GraceTime extends the LifeTime by stale-while-revalidate, the StaleTime by stale-if-error.
+// Tags are taken from the Surrogate-Key (space separated) and Cache-Tag (comma separated) headers.
+// The policy is applied for missing headers.
+func NewEntryFromResponse(resp *http.Response, policy ResponsePolicy) (Entry, error) {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	now := time.Now()
+	directives := parseCacheControl(resp.Header.Values("Cache-Control"))
+
+	lifeTime := now.Add(freshnessLifetime(resp.Header, directives, now, policy) - responseAge(resp.Header, now))
+
+	graceTime := policy.DefaultGraceTime
+	if directives.mustRevalidate() {
+		graceTime = 0
+	}
+
+	meta := Meta{
+		LifeTime:  lifeTime,
+		GraceTime: lifeTime.Add(directives.seconds("stale-while-revalidate", graceTime)),
+		Tags:      responseTags(resp.Header),
+	}
+
+	if staleIfError, found := directives["stale-if-error"]; found {
+		if seconds, err := strconv.Atoi(staleIfError); err == nil && seconds > 0 {
+			meta.StaleTime = lifeTime.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	return Entry{
+		Meta:       meta,
+		Header:     resp.Header.Clone(),
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}, nil
+}
+
+// freshnessLifetime of the response, see RFC 9111 section 4.2.1
+func freshnessLifetime(header http.Header, directives cacheControl, now time.Time, policy ResponsePolicy) time.Duration {
+	if directives.mustRevalidate() {
+		return 0
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, found := directives[directive]; found {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				return max(time.Duration(seconds)*time.Second, 0)
+			}
+		}
+	}
+
+	if expiresHeader := header.Get("Expires"); expiresHeader != "" {
+		// invalid dates, especially "0", represent a time in the past
+		expires, err := http.ParseTime(expiresHeader)
+		if err != nil {
+			return 0
+		}
+
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+
+		return max(expires.Sub(date), 0)
+	}
+
+	return policy.DefaultLifeTime
+}
+
+// responseAge is the time the response already spent in caches, see RFC 9111 section 4.2.3
+func responseAge(header http.Header, now time.Time) time.Duration {
+	var age time.Duration
+
+	if seconds, err := strconv.Atoi(header.Get("Age")); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		age = max(age, now.Sub(date))
+	}
+
+	return age
+}
+
+func responseTags(header http.Header) []string {
+	var tags []string
+
+	for _, value := range header.Values("Surrogate-Key") {
+		tags = append(tags, strings.Fields(value)...)
+	}
+
+	for _, value := range header.Values("Cache-Tag") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	slices.Sort(tags)
+
+	return slices.Compact(tags)
+}
+
+func parseCacheControl(values []string) cacheControl {
+	directives := make(cacheControl)
+
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+
+			directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+		}
+	}
+
+	return directives
+}
+
+// mustRevalidate reports whether a stored response must not be served without asking the origin
+func (c cacheControl) mustRevalidate() bool {
+	return c.has("no-store") || c.has("no-cache") || c.has("private")
+}
+
+// notStorable reports whether the response must not be stored in a shared cache
+func (c cacheControl) notStorable() bool {
+	return c.has("no-store") || c.has("private")
+}
+
+func (c cacheControl) has(directive string) bool {
+	_, found := c[directive]
+
+	return found
+}
+
+// seconds of the directive as duration, fallback if the directive is missing or invalid
+func (c cacheControl) seconds(directive string, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(c[directive])
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+
+	return time.Duration(seconds) * time.Second
+}
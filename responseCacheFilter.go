@@ -0,0 +1,357 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"flamingo.me/dingo"
+	"flamingo.me/flamingo/v3/framework/config"
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"flamingo.me/flamingo/v3/framework/web"
+	"go.opencensus.io/trace"
+)
+
+const (
+	defaultResponseCacheLifeTime  = 5 * time.Minute
+	defaultResponseCacheGraceTime = 5 * time.Minute
+	// defaultSessionCookie is the default name of the flamingo session cookie, see flamingo.session.name
+	defaultSessionCookie = "flamingo"
+)
+
+type (
+	// ResponseCacheFilter caches whole controller responses of the configured routes in a Frontend
+	ResponseCacheFilter struct {
+		frontend *Frontend
+		routes   []ResponseCacheRoute
+		logger   flamingo.Logger
+		// sessionCookie is the name of the cookie identifying the session of a user
+		sessionCookie string
+		// cacheStatusHeader adds the Cache-Status header to responses served by the frontend
+		cacheStatusHeader bool
+	}
+
+	// ResponseCacheConfig typed configuration of the ResponseCacheFilter
+	ResponseCacheConfig struct {
+		// Frontend is the name of the configured cache used to store the responses
+		Frontend string
+		Routes   []ResponseCacheRoute
+		// CacheStatusHeader adds the Cache-Status header (RFC 9211) to the responses
+		CacheStatusHeader bool
+	}
+
+	// ResponseCacheRoute configures the caching of all requests matching the Path.
+	// Cookies are not part of the key, so requests carrying the session cookie are not cached unless CacheSessions is set.
+	ResponseCacheRoute struct {
+		// Path pattern of the request path, see path.Match
+		Path string
+		// LifeTimeSeconds until the response is rendered again
+		LifeTimeSeconds int
+		// GraceTimeSeconds beyond the LifeTime the response is served while it is rendered again in the background
+		GraceTimeSeconds int
+		// Tags of the stored responses, additionally to the Surrogate-Key and Cache-Tag headers of the response
+		Tags []string
+		// KeyQueryParams restrict the query parameters used in the cache key, all are used if empty
+		KeyQueryParams []string
+		// IgnoreQuery removes the query from the cache key completely
+		IgnoreQuery bool
+		// KeyHeaders are request headers which are part of the cache key
+		KeyHeaders []string
+		// CacheSessions caches requests carrying the session cookie, the response must not depend on the session
+		CacheSessions bool
+	}
+
+	// responseRecorder captures the response of the filter chain
+	responseRecorder struct {
+		header     http.Header
+		statusCode int
+		body       bytes.Buffer
+	}
+)
+
+var (
+	_ web.Filter          = new(ResponseCacheFilter)
+	_ http.ResponseWriter = new(responseRecorder)
+)
+
+// Inject dependencies, the frontend is resolved by the name configured in httpcache.responseCache.frontend
+func (f *ResponseCacheFilter) Inject(
+	logger flamingo.Logger,
+	injector *dingo.Injector,
+	cfg *struct {
+		ResponseCacheConfig config.Map `inject:"config:httpcache.responseCache,optional"`
+		SessionCookie       string     `inject:"config:flamingo.session.name,optional"`
+	},
+) *ResponseCacheFilter {
+	f.logger = logger
+
+	if cfg != nil && cfg.SessionCookie != "" {
+		f.sessionCookie = cfg.SessionCookie
+	}
+
+	if cfg == nil || cfg.ResponseCacheConfig == nil {
+		return f
+	}
+
+	var responseCacheConfig ResponseCacheConfig
+
+	err := cfg.ResponseCacheConfig.MapInto(&responseCacheConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	f.routes = responseCacheConfig.Routes
+	f.cacheStatusHeader = responseCacheConfig.CacheStatusHeader
+
+	if injector != nil && responseCacheConfig.Frontend != "" {
+		instance, err := injector.GetAnnotatedInstance(new(Frontend), responseCacheConfig.Frontend)
+		if err != nil {
+			panic(fmt.Errorf("response cache frontend %q: %w", responseCacheConfig.Frontend, err))
+		}
+
+		if frontend, ok := instance.(*Frontend); ok {
+			f.frontend = frontend
+		}
+	}
+
+	return f
+}
+
+// SetFrontend storing the responses
+func (f *ResponseCacheFilter) SetFrontend(frontend *Frontend) *ResponseCacheFilter {
+	f.frontend = frontend
+
+	return f
+}
+
+// SetRoutes which responses are cached, the first matching route is used
+func (f *ResponseCacheFilter) SetRoutes(routes []ResponseCacheRoute) *ResponseCacheFilter {
+	f.routes = routes
+
+	return f
+}
+
+// SetSessionCookie sets the name of the session cookie, requests carrying it are only cached by routes with CacheSessions
+func (f *ResponseCacheFilter) SetSessionCookie(name string) *ResponseCacheFilter {
+	f.sessionCookie = name
+
+	return f
+}
+
+// SetCacheStatusHeader enables the Cache-Status header (RFC 9211) on responses served by the frontend
+func (f *ResponseCacheFilter) SetCacheStatusHeader(enabled bool) *ResponseCacheFilter {
+	f.cacheStatusHeader = enabled
+
+	return f
+}
+
+// Filter serves GET and HEAD requests of the configured routes from the frontend.
+// Requests carrying the session cookie are passed on, unless the route caches sessions.
+// Responses are only stored if their status code is cacheable by default, they don't set cookies
+// and their Cache-Control header does not contain no-store or private. A not modified response of the controller
+// to a conditional request of the client is passed through to this request only.
+func (f *ResponseCacheFilter) Filter(ctx context.Context, req *web.Request, w http.ResponseWriter, chain *web.FilterChain) web.Result {
+	httpRequest := req.Request()
+
+	route, found := f.matchRoute(httpRequest)
+	if !found || f.frontend == nil {
+		return chain.Next(ctx, req, w)
+	}
+
+	var rendered bool
+
+	// stored bodies compressed in a coding accepted by the client are passed on as they are
+	lookupCtx := WithAcceptEncoding(ctx, strings.Join(httpRequest.Header.Values("Accept-Encoding"), ","))
+
+	entry, info, err := f.frontend.GetVariantWithInfo(lookupCtx, route.key(httpRequest), httpRequest.Header, func(loaderCtx context.Context) (Entry, error) {
+		rendered = true
+
+		// the controllers need the values of the request context, but rendering must not be canceled by a single client
+		renderCtx := trace.NewContext(context.WithoutCancel(ctx), trace.FromContext(loaderCtx))
+
+		recorder := newResponseRecorder()
+
+		if result := chain.Next(renderCtx, req, recorder); result != nil {
+			if err := result.Apply(renderCtx, recorder); err != nil {
+				return Entry{}, fmt.Errorf("failed to apply result: %w", err)
+			}
+		}
+
+		recorded := route.entry(recorder)
+		// uncacheable responses are passed through to this request only
+		recorded.Meta.NoStore = !isStorableResponse(recorded)
+
+		return recorded, nil
+	})
+	if err == nil {
+		result := resultFromEntry(entry)
+		if f.cacheStatusHeader {
+			addCacheStatusHeader(result.Header, info)
+		}
+
+		return result
+	}
+
+	if !rendered {
+		// the response was rendered for another request or the frontend failed before rendering
+		return chain.Next(ctx, req, w)
+	}
+
+	if f.logger != nil {
+		f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+			Error(fmt.Sprintf("Failed to render response for %q: %v", httpRequest.URL.Path, err))
+	}
+
+	return &web.Response{
+		Status: http.StatusInternalServerError,
+		Header: make(http.Header),
+		Body:   strings.NewReader(http.StatusText(http.StatusInternalServerError)),
+	}
+}
+
+func (f *ResponseCacheFilter) matchRoute(req *http.Request) (ResponseCacheRoute, bool) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ResponseCacheRoute{}, false
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		return ResponseCacheRoute{}, false
+	}
+
+	for _, route := range f.routes {
+		if matched, err := path.Match(route.Path, req.URL.Path); err == nil && matched {
+			return route, route.CacheSessions || !f.hasSession(req)
+		}
+	}
+
+	return ResponseCacheRoute{}, false
+}
+
+// hasSession reports whether the request carries the session cookie
+func (f *ResponseCacheFilter) hasSession(req *http.Request) bool {
+	name := f.sessionCookie
+	if name == "" {
+		name = defaultSessionCookie
+	}
+
+	_, err := req.Cookie(name)
+
+	return err == nil
+}
+
+// key of the request composed of method, host, path and the configured query parameters and headers
+func (r ResponseCacheRoute) key(req *http.Request) string {
+	var key strings.Builder
+
+	key.WriteString(req.Method + " " + req.Host + req.URL.Path)
+
+	if !r.IgnoreQuery {
+		query := req.URL.Query()
+
+		if len(r.KeyQueryParams) > 0 {
+			for name := range query {
+				if !slices.Contains(r.KeyQueryParams, name) {
+					query.Del(name)
+				}
+			}
+		}
+
+		if len(query) > 0 {
+			key.WriteString("?" + query.Encode())
+		}
+	}
+
+	for _, name := range r.KeyHeaders {
+		key.WriteString(" " + http.CanonicalHeaderKey(name) + "=" + strings.Join(req.Header.Values(name), ","))
+	}
+
+	return key.String()
+}
+
+func (r ResponseCacheRoute) entry(recorder *responseRecorder) Entry {
+	lifeTime := defaultResponseCacheLifeTime
+	if r.LifeTimeSeconds > 0 {
+		lifeTime = time.Duration(r.LifeTimeSeconds) * time.Second
+	}
+
+	graceTime := defaultResponseCacheGraceTime
+	if r.GraceTimeSeconds > 0 {
+		graceTime = time.Duration(r.GraceTimeSeconds) * time.Second
+	}
+
+	statusCode := recorder.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	tags := append(slices.Clone(r.Tags), responseTags(recorder.header)...)
+	slices.Sort(tags)
+
+	now := time.Now()
+
+	return Entry{
+		Meta: Meta{
+			LifeTime:  now.Add(lifeTime),
+			GraceTime: now.Add(lifeTime + graceTime),
+			Tags:      slices.Compact(tags),
+		},
+		Header:     recorder.header.Clone(),
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+		Body:       recorder.body.Bytes(),
+	}
+}
+
+// isStorableResponse reports whether the rendered response may be shared between clients
+func isStorableResponse(entry Entry) bool {
+	header := http.Header(entry.Header)
+
+	return isCacheableStatus(entry.StatusCode) &&
+		len(header.Values("Set-Cookie")) == 0 &&
+		!parseCacheControl(header.Values("Cache-Control")).notStorable()
+}
+
+func resultFromEntry(entry Entry) *web.Response {
+	header := http.Header(entry.Header).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	setBodyEncoding(header, entry)
+
+	return &web.Response{
+		Status: uint(entry.StatusCode), //nolint:gosec // status codes are positive
+		Header: header,
+		Body:   bytes.NewReader(entry.Body),
+	}
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header)}
+}
+
+// Header of the recorded response
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+// Write to the recorded body
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+
+	return r.body.Write(data) //nolint:wrapcheck // bytes.Buffer never returns an error
+}
+
+// WriteHeader records the first status code
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 {
+		r.statusCode = statusCode
+	}
+}
@@ -0,0 +1,199 @@
+package httpcache_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"flamingo.me/flamingo/v3/framework/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestResponseCacheFilter_Filter(t *testing.T) {
+	t.Parallel()
+
+	routes := []httpcache.ResponseCacheRoute{
+		{Path: "/product/*", LifeTimeSeconds: 60, Tags: []string{"product"}, KeyQueryParams: []string{"variant"}},
+		{Path: "/search", IgnoreQuery: true, KeyHeaders: []string{"Accept-Language"}},
+		{Path: "/static/*", CacheSessions: true},
+	}
+
+	setup := func(t *testing.T, action func(w http.ResponseWriter, r *http.Request)) (func(method, target string, header http.Header) *httptest.ResponseRecorder, *atomic.Int32, *httpcache.Frontend) {
+		t.Helper()
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+		filter := new(httpcache.ResponseCacheFilter).Inject(new(flamingo.NullLogger), nil, nil).SetFrontend(frontend).SetRoutes(routes)
+		calls := new(atomic.Int32)
+
+		serve := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+			httpRequest := httptest.NewRequestWithContext(t.Context(), method, target, nil)
+			for name, values := range header {
+				httpRequest.Header[name] = values
+			}
+
+			chain := web.NewFilterChain(func(_ context.Context, req *web.Request, w http.ResponseWriter) web.Result {
+				calls.Add(1)
+
+				rec := httptest.NewRecorder()
+				action(rec, req.Request())
+
+				return &web.Response{Status: uint(rec.Code), Header: rec.Header(), Body: rec.Body} //nolint:gosec // test status codes are positive
+			}, filter)
+
+			recorder := httptest.NewRecorder()
+			result := chain.Next(t.Context(), web.CreateRequest(httpRequest, nil), recorder)
+			require.NoError(t, result.Apply(t.Context(), recorder))
+
+			return recorder
+		}
+
+		return serve, calls, frontend
+	}
+
+	t.Run("responses of matching routes are cached", func(t *testing.T) {
+		t.Parallel()
+
+		serve, calls, frontend := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Surrogate-Key", "product-1")
+			_, _ = io.WriteString(w, "product "+r.URL.Query().Get("variant"))
+		})
+
+		for range 3 {
+			recorder := serve(http.MethodGet, "/product/1?variant=red&tracking=1", nil)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, "product red", recorder.Body.String())
+			assert.Equal(t, "product-1", recorder.Header().Get("Surrogate-Key"))
+		}
+
+		assert.Equal(t, int32(1), calls.Load())
+
+		_ = serve(http.MethodGet, "/product/1?variant=red&tracking=2", nil)
+		assert.Equal(t, int32(1), calls.Load(), "unconfigured query parameters are not part of the key")
+
+		_ = serve(http.MethodGet, "/product/1?variant=blue", nil)
+		assert.Equal(t, int32(2), calls.Load())
+
+		require.NoError(t, frontend.PurgeTags(t.Context(), "product-1"))
+		_ = serve(http.MethodGet, "/product/1?variant=red", nil)
+		assert.Equal(t, int32(3), calls.Load(), "tags of the response are stored")
+
+		require.NoError(t, frontend.PurgeTags(t.Context(), "product"))
+		_ = serve(http.MethodGet, "/product/1?variant=red", nil)
+		assert.Equal(t, int32(4), calls.Load(), "tags of the route are stored")
+	})
+
+	t.Run("key headers are part of the key", func(t *testing.T) {
+		t.Parallel()
+
+		serve, calls, _ := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Header.Get("Accept-Language"))
+		})
+
+		assert.Equal(t, "de", serve(http.MethodGet, "/search?q=1", http.Header{"Accept-Language": {"de"}}).Body.String())
+		assert.Equal(t, "de", serve(http.MethodGet, "/search?q=2", http.Header{"Accept-Language": {"de"}}).Body.String())
+		assert.Equal(t, "en", serve(http.MethodGet, "/search", http.Header{"Accept-Language": {"en"}}).Body.String())
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("unmatched routes and methods are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		serve, calls, _ := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "uncached")
+		})
+
+		for range 2 {
+			assert.Equal(t, "uncached", serve(http.MethodGet, "/checkout", nil).Body.String())
+			assert.Equal(t, "uncached", serve(http.MethodPost, "/product/1", nil).Body.String())
+		}
+
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("requests with a session are only cached by routes caching sessions", func(t *testing.T) {
+		t.Parallel()
+
+		serve, calls, _ := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "rendered")
+		})
+
+		session := http.Header{"Cookie": {"flamingo=session1"}}
+
+		for range 2 {
+			assert.Equal(t, "rendered", serve(http.MethodGet, "/product/1", session).Body.String())
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+
+		for range 2 {
+			assert.Equal(t, "rendered", serve(http.MethodGet, "/product/1", http.Header{"Cookie": {"tracking=1"}}).Body.String())
+			assert.Equal(t, "rendered", serve(http.MethodGet, "/static/logo", session).Body.String())
+		}
+
+		assert.Equal(t, int32(4), calls.Load(), "other cookies and routes caching sessions are cached")
+	})
+
+	t.Run("not modified responses to conditional requests of the client are passed through", func(t *testing.T) {
+		t.Parallel()
+
+		serve, calls, _ := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			_, _ = io.WriteString(w, "product")
+		})
+
+		recorder := serve(http.MethodGet, "/product/1", http.Header{"If-None-Match": {`"v1"`}})
+		assert.Equal(t, http.StatusNotModified, recorder.Code)
+		assert.Empty(t, recorder.Body.String())
+
+		recorder = serve(http.MethodGet, "/product/1", nil)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "product", recorder.Body.String(), "the not modified response is not stored")
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("responses which must not be shared are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		tests := map[string]func(w http.ResponseWriter, r *http.Request){
+			"server error": func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = io.WriteString(w, "failed")
+			},
+			"cookie": func(w http.ResponseWriter, _ *http.Request) {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+				_, _ = io.WriteString(w, "failed")
+			},
+			"private": func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "private")
+				_, _ = io.WriteString(w, "failed")
+			},
+		}
+
+		for name, action := range tests {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				serve, calls, _ := setup(t, action)
+
+				for range 2 {
+					assert.True(t, strings.HasPrefix(serve(http.MethodGet, "/product/1", nil).Body.String(), "failed"))
+				}
+
+				assert.Equal(t, int32(2), calls.Load())
+			})
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package httpcache_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestNewEntryFromResponse(t *testing.T) {
+	t.Parallel()
+
+	policy := httpcache.ResponsePolicy{
+		DefaultLifeTime:  time.Minute,
+		DefaultGraceTime: time.Hour,
+	}
+
+	createResponse := func(header http.Header) *http.Response {
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader("body")),
+		}
+	}
+
+	date := time.Now()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		// since is the point in time the wanted times are relative to, defaults to the start of the test
+		since         time.Time
+		wantLifeTime  time.Duration
+		wantGraceTime time.Duration
+		wantStaleTime time.Duration
+		wantTags      []string
+	}{
+		{
+			name:          "fallback policy without headers",
+			header:        http.Header{},
+			wantLifeTime:  time.Minute,
+			wantGraceTime: time.Minute + time.Hour,
+		},
+		{
+			name:          "max-age",
+			header:        http.Header{"Cache-Control": {"public, max-age=300"}},
+			wantLifeTime:  5 * time.Minute,
+			wantGraceTime: 5*time.Minute + time.Hour,
+		},
+		{
+			name:          "s-maxage takes precedence over max-age",
+			header:        http.Header{"Cache-Control": {"max-age=300, s-maxage=600"}},
+			wantLifeTime:  10 * time.Minute,
+			wantGraceTime: 10*time.Minute + time.Hour,
+		},
+		{
+			name:          "age reduces the lifetime",
+			header:        http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}},
+			wantLifeTime:  200 * time.Second,
+			wantGraceTime: 200*time.Second + time.Hour,
+		},
+		{
+			name: "expires relative to date",
+			header: http.Header{
+				"Date":    {date.UTC().Format(http.TimeFormat)},
+				"Expires": {date.Add(2 * time.Minute).UTC().Format(http.TimeFormat)},
+			},
+			since:         date,
+			wantLifeTime:  2 * time.Minute,
+			wantGraceTime: 2*time.Minute + time.Hour,
+		},
+		{
+			name:          "invalid expires is already expired",
+			header:        http.Header{"Expires": {"0"}},
+			wantLifeTime:  0,
+			wantGraceTime: time.Hour,
+		},
+		{
+			name:          "no-cache is stale immediately",
+			header:        http.Header{"Cache-Control": {"no-cache, max-age=300"}},
+			wantLifeTime:  0,
+			wantGraceTime: 0,
+		},
+		{
+			name:          "stale-while-revalidate and stale-if-error",
+			header:        http.Header{"Cache-Control": {`max-age=60, stale-while-revalidate="120", stale-if-error=600`}},
+			wantLifeTime:  time.Minute,
+			wantGraceTime: 3 * time.Minute,
+			wantStaleTime: 11 * time.Minute,
+		},
+		{
+			name: "tags from surrogate keys and cache tags",
+			header: http.Header{
+				"Surrogate-Key": {"product-1  cms"},
+				"Cache-Tag":     {"cms, category-2,"},
+			},
+			wantLifeTime:  time.Minute,
+			wantGraceTime: time.Minute + time.Hour,
+			wantTags:      []string{"category-2", "cms", "product-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Now()
+			if !tt.since.IsZero() {
+				now = tt.since
+			}
+
+			entry, err := httpcache.NewEntryFromResponse(createResponse(tt.header), policy)
+			require.NoError(t, err)
+
+			assert.Equal(t, []byte("body"), entry.Body)
+			assert.Equal(t, http.StatusOK, entry.StatusCode)
+			assert.Equal(t, "200 OK", entry.Status)
+			assert.Equal(t, map[string][]string(tt.header), entry.Header)
+			assert.Equal(t, tt.wantTags, entry.Meta.Tags)
+
+			assert.WithinDuration(t, now.Add(tt.wantLifeTime), entry.Meta.LifeTime, 2*time.Second)
+			assert.WithinDuration(t, now.Add(tt.wantGraceTime), entry.Meta.GraceTime, 2*time.Second)
+
+			if tt.wantStaleTime == 0 {
+				assert.True(t, entry.Meta.StaleTime.IsZero())
+			} else {
+				assert.WithinDuration(t, now.Add(tt.wantStaleTime), entry.Meta.StaleTime, 2*time.Second)
+			}
+		})
+	}
+}
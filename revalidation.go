@@ -0,0 +1,81 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+)
+
+var (
+	// ErrEntryNotFound is returned by ContextMetaUpdating backends if the entry to update is not stored
+	ErrEntryNotFound = errors.New("entry not found")
+	// ErrNotModifiedWithoutEntry is returned if a loader reports a revalidated entry without a previous entry
+	ErrNotModifiedWithoutEntry = errors.New("loader returned not modified without previous entry")
+)
+
+type previousEntryKey struct{}
+
+// PreviousEntry returns the stored entry the loader is called for, e.g. to send If-None-Match or If-Modified-Since.
+// If the upstream reports it unmodified, the loader returns an Entry with StatusCode http.StatusNotModified
+// and Meta.Revalidated set.
+func PreviousEntry(ctx context.Context) (Entry, bool) {
+	entry, ok := ctx.Value(previousEntryKey{}).(Entry)
+
+	return entry, ok
+}
+
+func withPreviousEntry(ctx context.Context, entry Entry) context.Context {
+	return context.WithValue(ctx, previousEntryKey{}, entry)
+}
+
+// isNotModified reports whether the loaded entry is a not modified response
+func isNotModified(entry Entry) bool {
+	return entry.StatusCode == http.StatusNotModified
+}
+
+// revalidated returns the previous entry with Meta and headers of the not modified entry, see RFC 9111 section 4.3.4
+func revalidated(previous Entry, notModified Entry) Entry {
+	entry := previous
+	entry.Meta = notModified.Meta
+	entry.Meta.Revalidated = false
+	entry.Header = mergeNotModifiedHeader(previous.Header, notModified.Header)
+
+	if entry.Meta.Tags == nil {
+		entry.Meta.Tags = previous.Meta.Tags
+	}
+
+	return entry
+}
+
+// mergeNotModifiedHeader replaces the stored headers with the ones of the not modified response,
+// except for the headers describing the stored body
+func mergeNotModifiedHeader(stored, notModified map[string][]string) map[string][]string {
+	merged := maps.Clone(stored)
+	if merged == nil {
+		merged = make(map[string][]string, len(notModified))
+	}
+
+	for name, values := range notModified {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+
+		merged[http.CanonicalHeaderKey(name)] = values
+	}
+
+	return merged
+}
+
+// set the entry in the backend, revalidated entries only get their meta data updated if the backend supports it
+func (f *Frontend) set(ctx context.Context, key string, entry Entry, notModified bool) error {
+	if updating, ok := f.backend.(ContextMetaUpdating); ok && notModified {
+		err := updating.UpdateMeta(ctx, key, entry)
+		if !errors.Is(err, ErrEntryNotFound) {
+			return err //nolint:wrapcheck // the error is logged by the caller
+		}
+	}
+
+	return f.backend.Set(ctx, key, entry) //nolint:wrapcheck // the error is logged by the caller
+}
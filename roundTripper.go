@@ -0,0 +1,213 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRoundTripperLifeTime  = 5 * time.Minute
+	defaultRoundTripperGraceTime = 5 * time.Minute
+)
+
+type (
+	// RoundTripper caches responses of safe requests in a Frontend and delegates everything else to the wrapped transport
+	RoundTripper struct {
+		frontend  *Frontend
+		transport http.RoundTripper
+		keyFunc   RoundTripperKeyFunc
+		policy    ResponsePolicy
+		// cacheStatusHeader adds the Cache-Status header to responses served by the frontend
+		cacheStatusHeader bool
+	}
+
+	// RoundTripperKeyFunc derives the cache key of a request
+	RoundTripperKeyFunc func(req *http.Request) string
+)
+
+var _ http.RoundTripper = new(RoundTripper)
+
+// NewRoundTripper caching in the frontend, a nil transport defaults to http.DefaultTransport
+func NewRoundTripper(frontend *Frontend, transport http.RoundTripper) *RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &RoundTripper{
+		frontend:  frontend,
+		transport: transport,
+		keyFunc:   DefaultRoundTripperKey,
+		policy: ResponsePolicy{
+			DefaultLifeTime:  defaultRoundTripperLifeTime,
+			DefaultGraceTime: defaultRoundTripperGraceTime,
+		},
+	}
+}
+
+// DefaultRoundTripperKey uses method and full URL of the request as cache key
+func DefaultRoundTripperKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// SetKeyFunc to derive cache keys from requests
+func (rt *RoundTripper) SetKeyFunc(keyFunc RoundTripperKeyFunc) *RoundTripper {
+	rt.keyFunc = keyFunc
+
+	return rt
+}
+
+// SetResponsePolicy used for responses without Cache-Control or Expires headers
+func (rt *RoundTripper) SetResponsePolicy(policy ResponsePolicy) *RoundTripper {
+	rt.policy = policy
+
+	return rt
+}
+
+// SetCacheStatusHeader enables the Cache-Status header (RFC 9211) on responses served by the frontend
+func (rt *RoundTripper) SetCacheStatusHeader(enabled bool) *RoundTripper {
+	rt.cacheStatusHeader = enabled
+
+	return rt
+}
+
+// RoundTrip serves GET and HEAD requests from the frontend, other requests are passed to the wrapped transport.
+// Requests carrying an Authorization header are never cached, since the frontend is shared between users.
+// Stored responses with an ETag or Last-Modified header are revalidated with a conditional request.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.isCacheableRequest(req) {
+		return rt.transport.RoundTrip(req) //nolint:wrapcheck // the response of the wrapped transport is passed through unchanged
+	}
+
+	// stored bodies compressed in a coding accepted by the client are passed on as they are
+	ctx := WithAcceptEncoding(req.Context(), strings.Join(req.Header.Values("Accept-Encoding"), ","))
+
+	entry, info, err := rt.frontend.GetVariantWithInfo(ctx, rt.keyFunc(req), req.Header, func(ctx context.Context) (Entry, error) {
+		outgoing := req.Clone(ctx)
+
+		previous, revalidating := PreviousEntry(ctx)
+		revalidating = revalidating && setConditionalHeaders(outgoing, previous)
+
+		resp, err := rt.transport.RoundTrip(outgoing)
+		if err != nil {
+			return Entry{}, err //nolint:wrapcheck // the frontend wraps loader errors
+		}
+
+		if revalidating && resp.StatusCode == http.StatusNotModified {
+			// the meta data is derived from the stored headers updated by the ones of the not modified response
+			resp.Header = mergeNotModifiedHeader(previous.Header, resp.Header)
+		}
+
+		loaded, err := NewEntryFromResponse(resp, rt.policy)
+		if err != nil {
+			return Entry{}, err
+		}
+
+		if revalidating && isNotModified(loaded) {
+			loaded.Meta.Revalidated = true
+
+			return loaded, nil
+		}
+
+		// uncacheable responses are passed through to this request only
+		loaded.Meta.NoStore = !isCacheableStatus(resp.StatusCode) || parseCacheControl(loaded.Header["Cache-Control"]).notStorable()
+
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := rt.responseFromEntry(req, entry)
+	if rt.cacheStatusHeader {
+		addCacheStatusHeader(resp.Header, info)
+	}
+
+	return resp, nil
+}
+
+func (rt *RoundTripper) isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	return req.Header.Get("Authorization") == "" && req.Header.Get("Range") == ""
+}
+
+// setConditionalHeaders of the stored entry, if the request has none itself. Returns whether the request is conditional.
+func setConditionalHeaders(req *http.Request, previous Entry) bool {
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+
+	header := http.Header(previous.Header)
+
+	if etag := header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+func (rt *RoundTripper) responseFromEntry(req *http.Request, entry Entry) *http.Response {
+	status := entry.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode))
+	}
+
+	header := http.Header(entry.Header).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	setBodyEncoding(header, entry)
+
+	contentLength := int64(len(entry.Body))
+	if req.Method == http.MethodHead {
+		contentLength = -1
+		if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			contentLength = length
+		}
+	}
+
+	return &http.Response{
+		Status:        status,
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: contentLength,
+		Request:       req,
+	}
+}
+
+// isCacheableStatus reports whether responses with the status code are cacheable by default, see RFC 9111 section 4.2.2
+func isCacheableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusOK,
+		http.StatusNonAuthoritativeInfo,
+		http.StatusNoContent,
+		http.StatusMultipleChoices,
+		http.StatusMovedPermanently,
+		http.StatusPermanentRedirect,
+		http.StatusNotFound,
+		http.StatusMethodNotAllowed,
+		http.StatusGone,
+		http.StatusRequestURITooLong,
+		http.StatusNotImplemented:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,354 @@
+package httpcache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"flamingo.me/httpcache"
+)
+
+func TestRoundTripper_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, handler http.HandlerFunc) (*http.Client, *httptest.Server, *atomic.Int32) {
+		t.Helper()
+
+		calls := new(atomic.Int32)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			handler(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend())
+		client := &http.Client{Transport: httpcache.NewRoundTripper(frontend, nil).SetResponsePolicy(httpcache.ResponsePolicy{
+			DefaultLifeTime:  time.Minute,
+			DefaultGraceTime: time.Minute,
+		})}
+
+		return client, server, calls
+	}
+
+	doRequest := func(t *testing.T, client *http.Client, method, url string) (*http.Response, string) {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(t.Context(), method, url, nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(body)
+	}
+
+	t.Run("GET is served from cache", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Test", "value")
+			_, _ = w.Write([]byte("cached body"))
+		})
+
+		for range 3 {
+			resp, body := doRequest(t, client, http.MethodGet, server.URL+"/path?query=1")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "200 OK", resp.Status)
+			assert.Equal(t, "value", resp.Header.Get("X-Test"))
+			assert.Equal(t, "cached body", body)
+		}
+
+		assert.Equal(t, int32(1), calls.Load())
+
+		_, _ = doRequest(t, client, http.MethodGet, server.URL+"/path?query=2")
+		assert.Equal(t, int32(2), calls.Load(), "query is part of the key")
+	})
+
+	t.Run("POST is not cached", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("posted"))
+		})
+
+		for range 2 {
+			_, body := doRequest(t, client, http.MethodPost, server.URL)
+			assert.Equal(t, "posted", body)
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("requests with authorization are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+		})
+
+		for _, user := range []string{"one", "two"} {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", user)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, user, string(body))
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("server errors are returned but not cached", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("upstream failed"))
+		})
+
+		for range 2 {
+			resp, body := doRequest(t, client, http.MethodGet, server.URL)
+			assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+			assert.True(t, strings.HasPrefix(body, "upstream failed"))
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("no-store responses are returned but not cached", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte("private"))
+		})
+
+		for range 2 {
+			resp, body := doRequest(t, client, http.MethodGet, server.URL)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "private", body)
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("uncacheable responses are neither negatively cached nor replaced by stale responses", func(t *testing.T) {
+		t.Parallel()
+
+		calls := new(atomic.Int32)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Cache-Control", "no-cache")
+				_, _ = w.Write([]byte("stored"))
+
+				return
+			}
+
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte("fresh"))
+		}))
+		t.Cleanup(server.Close)
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(createInMemoryBackend()).
+			SetNegativeCache(time.Minute, 10).SetStaleIfError(time.Hour)
+		client := &http.Client{Transport: httpcache.NewRoundTripper(frontend, nil)}
+
+		_, body := doRequest(t, client, http.MethodGet, server.URL)
+		assert.Equal(t, "stored", body)
+
+		for range 2 {
+			resp, body := doRequest(t, client, http.MethodGet, server.URL)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "fresh", body)
+		}
+
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("expired responses are reloaded", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=0")
+			_, _ = w.Write([]byte("expired"))
+		})
+
+		_, _ = doRequest(t, client, http.MethodGet, server.URL)
+		_, _ = doRequest(t, client, http.MethodGet, server.URL)
+
+		assert.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("stored responses are revalidated", func(t *testing.T) {
+		t.Parallel()
+
+		conditional := new(atomic.Int32)
+
+		client, server, calls := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", `"v1"`)
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			_, _ = w.Write([]byte("full body"))
+		})
+
+		_, body := doRequest(t, client, http.MethodGet, server.URL)
+		assert.Equal(t, "full body", body)
+
+		assert.Eventually(t, func() bool {
+			resp, body := doRequest(t, client, http.MethodGet, server.URL)
+
+			return conditional.Load() > 0 && resp.StatusCode == http.StatusOK && body == "full body"
+		}, time.Second, 10*time.Millisecond)
+
+		assert.GreaterOrEqual(t, calls.Load(), int32(2))
+	})
+
+	t.Run("conditional requests of the client are answered by the upstream", func(t *testing.T) {
+		t.Parallel()
+
+		client, server, _ := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			_, _ = w.Write([]byte("full body"))
+		})
+
+		conditional := func(t *testing.T) *http.Response {
+			t.Helper()
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("If-None-Match", `"v1"`)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			return resp
+		}
+
+		// miss
+		assert.Equal(t, http.StatusNotModified, conditional(t).StatusCode)
+
+		resp, body := doRequest(t, client, http.MethodGet, server.URL)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "full body", body)
+
+		// hit
+		assert.Equal(t, http.StatusNotModified, conditional(t).StatusCode)
+
+		resp, body = doRequest(t, client, http.MethodGet, server.URL)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "full body", body, "the stored entry is kept")
+	})
+
+	t.Run("cache status header is added if enabled", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = w.Write([]byte("body"))
+		}))
+		t.Cleanup(server.Close)
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetName("api").SetContextBackend(createInMemoryBackend())
+		client := &http.Client{Transport: httpcache.NewRoundTripper(frontend, nil).SetCacheStatusHeader(true)}
+
+		resp, _ := doRequest(t, client, http.MethodGet, server.URL)
+		assert.Regexp(t, `^api; fwd=uri-miss; stored; ttl=(59|60)$`, resp.Header.Get("Cache-Status"))
+
+		resp, _ = doRequest(t, client, http.MethodGet, server.URL)
+		assert.Regexp(t, `^api; hit; ttl=(59|60); detail=memory$`, resp.Header.Get("Cache-Status"))
+	})
+
+	t.Run("compressed bodies are served to clients accepting their encoding", func(t *testing.T) {
+		t.Parallel()
+
+		body := strings.Repeat("compressible body ", 100)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+
+		backend, err := new(httpcache.InMemoryBackendFactory).SetConfig(httpcache.MemoryBackendConfig{
+			Size:        10,
+			Compression: &httpcache.CompressionConfig{Algorithm: httpcache.CompressionGzip},
+		}).Build()
+		require.NoError(t, err)
+
+		frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+		client := &http.Client{Transport: httpcache.NewRoundTripper(frontend, nil)}
+
+		get := func(acceptEncoding string) (*http.Response, []byte) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+
+			if acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+			}
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			return resp, data
+		}
+
+		_, data := get("gzip")
+		assert.Equal(t, body, string(data), "the loaded body is not compressed")
+
+		resp, data := get("br, gzip")
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		assert.Less(t, len(data), len(body))
+
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		decompressed, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decompressed))
+
+		resp, data = get("gzip;q=0")
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, body, string(data))
+	})
+}
@@ -1,16 +1,25 @@
 package httpcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
 	"flamingo.me/flamingo/v3/framework/flamingo"
 )
 
 var (
-	_ Backend            = new(TwoLevelBackend)
-	_ healthcheck.Status = new(TwoLevelBackend)
+	_ ContextBackend         = new(TwoLevelBackend)
+	_ ContextTagSupporting   = new(TwoLevelBackend)
+	_ ContextTagCounting     = new(TwoLevelBackend)
+	_ ContextMetaUpdating    = new(TwoLevelBackend)
+	_ ContextVariantIndexing = new(TwoLevelBackend)
+	_ healthcheck.Status     = new(TwoLevelBackend)
+	_ Closing                = new(TwoLevelBackend)
 
 	ErrAllBackendsFailed       = errors.New("all backends failed")
 	ErrAtLeastOneBackendFailed = errors.New("at least one backends failed")
@@ -19,15 +28,15 @@ var (
 type (
 	// TwoLevelBackend the cache backend interface with a two level solution
 	TwoLevelBackend struct {
-		firstBackend  Backend
-		secondBackend Backend
+		firstBackend  ContextBackend
+		secondBackend ContextBackend
 		logger        flamingo.Logger
 	}
 
 	// TwoLevelBackendConfig defines the backends to be used
 	TwoLevelBackendConfig struct {
-		FirstLevel  Backend
-		SecondLevel Backend
+		FirstLevel  ContextBackend
+		SecondLevel ContextBackend
 	}
 
 	// TwoLevelBackendFactory creates instances of TwoLevel backends
@@ -50,7 +59,7 @@ func (f *TwoLevelBackendFactory) SetConfig(config TwoLevelBackendConfig) *TwoLev
 }
 
 // Build the instance
-func (f *TwoLevelBackendFactory) Build() (Backend, error) {
+func (f *TwoLevelBackendFactory) Build() (ContextBackend, error) {
 	return &TwoLevelBackend{
 		firstBackend:  f.config.FirstLevel,
 		secondBackend: f.config.SecondLevel,
@@ -58,37 +67,55 @@ func (f *TwoLevelBackendFactory) Build() (Backend, error) {
 	}, nil
 }
 
-// Get entry by key
-func (mb *TwoLevelBackend) Get(key string) (entry Entry, found bool) {
-	entry, found = mb.firstBackend.Get(key)
+// Get entry by key, a failing first level falls back to the second level
+func (mb *TwoLevelBackend) Get(ctx context.Context, key string) (Entry, bool, error) {
+	entry, found, firstErr := mb.firstBackend.Get(ctx, key)
+	if firstErr != nil {
+		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed to get key %v from first backend with error %v", key, firstErr))
+	}
+
 	if found {
-		return entry, found
+		reportServingLevel(ctx, "first")
+
+		return entry, found, nil
+	}
+
+	entry, found, secondErr := mb.secondBackend.Get(ctx, key)
+	if secondErr != nil {
+		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed to get key %v from second backend with error %v", key, secondErr))
+
+		if firstErr != nil {
+			return Entry{}, false, fmt.Errorf("failed to Get key %v, errors: %v - %w", key, []error{firstErr, secondErr}, ErrAllBackendsFailed)
+		}
+
+		return Entry{}, false, fmt.Errorf("second backend failed to Get key %v: %w", key, secondErr)
 	}
 
-	entry, found = mb.secondBackend.Get(key)
 	if found {
+		reportServingLevel(ctx, "second")
+
 		go func() {
-			_ = mb.firstBackend.Set(key, entry)
+			_ = mb.firstBackend.Set(context.WithoutCancel(ctx), key, entry)
 		}()
 
-		return entry, true
+		return entry, true, nil
 	}
 
-	return Entry{}, false
+	return Entry{}, false, nil
 }
 
 // Set entry for key
-func (mb *TwoLevelBackend) Set(key string, entry Entry) error {
+func (mb *TwoLevelBackend) Set(ctx context.Context, key string, entry Entry) error {
 	errorCount := 0
 
-	err := mb.firstBackend.Set(key, entry)
+	err := mb.firstBackend.Set(ctx, key, entry)
 	if err != nil {
 		errorCount++
 
 		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed to set key %v with error %v", key, err))
 	}
 
-	err = mb.secondBackend.Set(key, entry)
+	err = mb.secondBackend.Set(ctx, key, entry)
 	if err != nil {
 		errorCount++
 
@@ -102,17 +129,45 @@ func (mb *TwoLevelBackend) Set(key string, entry Entry) error {
 	return nil
 }
 
+// UpdateMeta on every level supporting it, the entry is set on levels without support or without the key
+func (mb *TwoLevelBackend) UpdateMeta(ctx context.Context, key string, entry Entry) error {
+	errorCount := 0
+
+	for _, backend := range []ContextBackend{mb.firstBackend, mb.secondBackend} {
+		err := ErrEntryNotFound
+		if updating, ok := backend.(ContextMetaUpdating); ok {
+			err = updating.UpdateMeta(ctx, key, entry)
+		}
+
+		if errors.Is(err, ErrEntryNotFound) {
+			err = backend.Set(ctx, key, entry)
+		}
+
+		if err != nil {
+			errorCount++
+
+			mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed to update meta of key %v with error %v", key, err))
+		}
+	}
+
+	if errorCount >= 2 { //nolint:mnd // there are two backends no need to introduce const for that
+		return ErrAllBackendsFailed
+	}
+
+	return nil
+}
+
 // Purge entry by key
-func (mb *TwoLevelBackend) Purge(key string) (err error) {
+func (mb *TwoLevelBackend) Purge(ctx context.Context, key string) (err error) {
 	var errorList []error
 
-	err = mb.firstBackend.Purge(key)
+	err = mb.firstBackend.Purge(ctx, key)
 	if err != nil {
 		errorList = append(errorList, err)
 		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed Purge with error %v", err))
 	}
 
-	err = mb.secondBackend.Purge(key)
+	err = mb.secondBackend.Purge(ctx, key)
 	if err != nil {
 		errorList = append(errorList, err)
 		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed Purge with error %v", err))
@@ -126,16 +181,16 @@ func (mb *TwoLevelBackend) Purge(key string) (err error) {
 }
 
 // Flush the whole cache
-func (mb *TwoLevelBackend) Flush() (err error) {
+func (mb *TwoLevelBackend) Flush(ctx context.Context) (err error) {
 	var errorList []error
 
-	err = mb.firstBackend.Flush()
+	err = mb.firstBackend.Flush(ctx)
 	if err != nil {
 		errorList = append(errorList, err)
 		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed Flush error %v", err))
 	}
 
-	err = mb.secondBackend.Flush()
+	err = mb.secondBackend.Flush(ctx)
 	if err != nil {
 		errorList = append(errorList, err)
 		mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed Flush error %v", err))
@@ -148,26 +203,182 @@ func (mb *TwoLevelBackend) Flush() (err error) {
 	return nil
 }
 
-// Status checks the health of the used backends
+// PurgeTags on every level supporting tags, returns ErrTagsNotSupported if no level does
+func (mb *TwoLevelBackend) PurgeTags(ctx context.Context, tags []string) error {
+	_, err := mb.PurgeTagsWithCount(ctx, tags)
+
+	return err
+}
+
+// PurgeTagsWithCount on every level supporting tags and returns the highest number of entries purged on a level,
+// since the levels store the same entries. Levels not counting purged entries are not considered.
+func (mb *TwoLevelBackend) PurgeTagsWithCount(ctx context.Context, tags []string) (int, error) {
+	var errorList []error
+
+	supported := false
+	purged := 0
+
+	for _, backend := range []ContextBackend{mb.firstBackend, mb.secondBackend} {
+		tagSupporting, ok := backend.(ContextTagSupporting)
+		if !ok {
+			continue
+		}
+
+		count := 0
+
+		var err error
+
+		if tagCounting, ok := backend.(ContextTagCounting); ok {
+			count, err = tagCounting.PurgeTagsWithCount(ctx, tags)
+		} else {
+			err = tagSupporting.PurgeTags(ctx, tags)
+		}
+
+		if errors.Is(err, ErrTagsNotSupported) {
+			continue
+		}
+
+		supported = true
+		purged = max(purged, count)
+
+		if err != nil {
+			errorList = append(errorList, err)
+			mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed PurgeTags with error %v", err))
+		}
+	}
+
+	if !supported {
+		return 0, ErrTagsNotSupported
+	}
+
+	if len(errorList) != 0 {
+		return purged, fmt.Errorf("not all backends succeeded to PurgeTags %v, errors: %v - %w", tags, errorList, ErrAtLeastOneBackendFailed)
+	}
+
+	return purged, nil
+}
+
+// AddVariant on every level supporting variant indexes, returns ErrVariantIndexNotSupported if no level does
+func (mb *TwoLevelBackend) AddVariant(ctx context.Context, key string, variant string, keepUntil time.Time) error {
+	var errorList []error
+
+	supported := false
+
+	for _, backend := range []ContextBackend{mb.firstBackend, mb.secondBackend} {
+		indexing, ok := backend.(ContextVariantIndexing)
+		if !ok {
+			continue
+		}
+
+		err := indexing.AddVariant(ctx, key, variant, keepUntil)
+		if errors.Is(err, ErrVariantIndexNotSupported) {
+			continue
+		}
+
+		supported = true
+
+		if err != nil {
+			errorList = append(errorList, err)
+			mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed AddVariant with error %v", err))
+		}
+	}
+
+	if !supported {
+		return ErrVariantIndexNotSupported
+	}
+
+	if len(errorList) != 0 {
+		return fmt.Errorf("not all backends succeeded to AddVariant of key %v, errors: %v - %w", key, errorList, ErrAtLeastOneBackendFailed)
+	}
+
+	return nil
+}
+
+// RemoveVariants of every level supporting variant indexes and returns the variants of all levels,
+// returns ErrVariantIndexNotSupported if no level does
+func (mb *TwoLevelBackend) RemoveVariants(ctx context.Context, key string) ([]string, error) {
+	var (
+		errorList []error
+		variants  []string
+	)
+
+	supported := false
+
+	for _, backend := range []ContextBackend{mb.firstBackend, mb.secondBackend} {
+		indexing, ok := backend.(ContextVariantIndexing)
+		if !ok {
+			continue
+		}
+
+		removed, err := indexing.RemoveVariants(ctx, key)
+		if errors.Is(err, ErrVariantIndexNotSupported) {
+			continue
+		}
+
+		supported = true
+		variants = append(variants, removed...)
+
+		if err != nil {
+			errorList = append(errorList, err)
+			mb.logger.WithField("category", "TwoLevelBackend").Error(fmt.Sprintf("Failed RemoveVariants with error %v", err))
+		}
+	}
+
+	if !supported {
+		return nil, ErrVariantIndexNotSupported
+	}
+
+	slices.Sort(variants)
+	variants = slices.Compact(variants)
+
+	if len(errorList) != 0 {
+		return variants, fmt.Errorf("not all backends succeeded to RemoveVariants of key %v, errors: %v - %w", key, errorList, ErrAtLeastOneBackendFailed)
+	}
+
+	return variants, nil
+}
+
+// Status checks the health of the used backends, the notes of the levels are included even if they are alive,
+// e.g. the redis master in use
 func (mb *TwoLevelBackend) Status() (bool, string) {
 	healthy := true
-	details := ""
 
-	if firstHealth, ok := mb.firstBackend.(healthcheck.Status); ok {
-		alive, notes := firstHealth.Status()
-		if !alive {
-			healthy = false
-			details += fmt.Sprintf("first backend: %s", notes)
+	var details []string
+
+	levels := []struct {
+		name    string
+		backend ContextBackend
+	}{{"first", mb.firstBackend}, {"second", mb.secondBackend}}
+
+	for _, level := range levels {
+		health, ok := level.backend.(healthcheck.Status)
+		if !ok {
+			continue
 		}
-	}
 
-	if secondHealth, ok := mb.secondBackend.(healthcheck.Status); ok {
-		alive, notes := secondHealth.Status()
+		alive, notes := health.Status()
 		if !alive {
 			healthy = false
-			details += fmt.Sprintf("second backend: %s", notes)
 		}
+
+		if notes != "" {
+			details = append(details, fmt.Sprintf("%s backend: %s", level.name, notes))
+		}
+	}
+
+	return healthy, strings.Join(details, "; ")
+}
+
+// Close both levels implementing Closing
+func (mb *TwoLevelBackend) Close() error {
+	return errors.Join(closeBackend(mb.firstBackend), closeBackend(mb.secondBackend))
+}
+
+// reportServingLevel prefixes the backend reported by the level with the level
+func reportServingLevel(ctx context.Context, level string) {
+	if backend := servingBackend(ctx); backend != "" {
+		level += ":" + backend
 	}
 
-	return healthy, details
+	ReportServingBackend(ctx, level)
 }
@@ -1,17 +1,23 @@
 package httpcache_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"flamingo.me/flamingo/v3/core/healthcheck/domain/healthcheck"
 	"flamingo.me/flamingo/v3/framework/flamingo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"flamingo.me/httpcache"
+	"flamingo.me/httpcache/mocks"
 )
 
-func createInMemoryBackend() httpcache.Backend {
-	return func() httpcache.Backend {
+func createInMemoryBackend() httpcache.ContextBackend {
+	return func() httpcache.ContextBackend {
 		f := httpcache.InMemoryBackendFactory{}
 		backend, _ := f.SetConfig(httpcache.MemoryBackendConfig{Size: 100}).SetFrontendName("default").SetLurkerPeriod(100 * time.Millisecond).Build()
 
@@ -33,3 +39,151 @@ func Test_RunDefaultBackendTestCase_TwoLevelBackend(t *testing.T) {
 	testcase := NewBackendTestCase(t, backend, true)
 	testcase.RunTests()
 }
+
+func TestTwoLevelBackend_ServingLevel(t *testing.T) {
+	t.Parallel()
+
+	first := createInMemoryBackend()
+	second := createInMemoryBackend()
+
+	backend, err := new(httpcache.TwoLevelBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.TwoLevelBackendConfig{
+		FirstLevel:  first,
+		SecondLevel: second,
+	}).Build()
+	require.NoError(t, err)
+
+	entry := httpcache.Entry{Meta: httpcache.Meta{LifeTime: time.Now().Add(time.Minute), GraceTime: time.Now().Add(time.Minute)}}
+	require.NoError(t, second.Set(t.Context(), "key", entry))
+
+	frontend := new(httpcache.Frontend).Inject(new(flamingo.NullLogger)).SetContextBackend(backend)
+	loader := func(context.Context) (httpcache.Entry, error) { return entry, nil }
+
+	_, info, err := frontend.GetWithInfo(t.Context(), "key", loader)
+	require.NoError(t, err)
+	assert.Equal(t, "second:memory", info.Backend)
+
+	// the second level fills the first level in background
+	assert.Eventually(t, func() bool {
+		_, info, err = frontend.GetWithInfo(t.Context(), "key", loader)
+
+		return err == nil && info.Backend == "first:memory"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTwoLevelBackend_PurgeTags(t *testing.T) {
+	t.Parallel()
+
+	t.Run("purges every level supporting tags", func(t *testing.T) {
+		t.Parallel()
+
+		first := mocks.NewContextBackend(t)
+		second := mocks.NewContextTagSupporting(t)
+		second.EXPECT().PurgeTags(mock.Anything, []string{"tag"}).Return(nil).Once()
+
+		backend, err := new(httpcache.TwoLevelBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.TwoLevelBackendConfig{
+			FirstLevel:  first,
+			SecondLevel: tagSupportingBackend{ContextBackend: mocks.NewContextBackend(t), ContextTagSupporting: second},
+		}).Build()
+		require.NoError(t, err)
+
+		tagSupporting, ok := backend.(httpcache.ContextTagSupporting)
+		require.True(t, ok)
+		assert.NoError(t, tagSupporting.PurgeTags(context.Background(), []string{"tag"}))
+	})
+
+	t.Run("no level supports tags", func(t *testing.T) {
+		t.Parallel()
+
+		backend, err := new(httpcache.TwoLevelBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.TwoLevelBackendConfig{
+			FirstLevel:  mocks.NewContextBackend(t),
+			SecondLevel: httpcache.AdaptBackend(mocks.NewBackend(t)),
+		}).Build()
+		require.NoError(t, err)
+
+		tagSupporting, ok := backend.(httpcache.ContextTagSupporting)
+		require.True(t, ok)
+		assert.ErrorIs(t, tagSupporting.PurgeTags(context.Background(), []string{"tag"}), httpcache.ErrTagsNotSupported)
+	})
+}
+
+// closingBackend counts how often it is closed
+type closingBackend struct {
+	httpcache.ContextBackend
+	closed *int
+	err    error
+}
+
+func (b closingBackend) Close() error {
+	*b.closed++
+
+	return b.err
+}
+
+func TestTwoLevelBackend_Close(t *testing.T) {
+	t.Parallel()
+
+	var firstClosed, secondClosed int
+
+	closeErr := errors.New("close failed")
+
+	backend, err := new(httpcache.TwoLevelBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.TwoLevelBackendConfig{
+		FirstLevel:  closingBackend{ContextBackend: createInMemoryBackend(), closed: &firstClosed, err: closeErr},
+		SecondLevel: closingBackend{ContextBackend: createInMemoryBackend(), closed: &secondClosed},
+	}).Build()
+	require.NoError(t, err)
+
+	closing, ok := httpcache.LegacyBackend(backend).(httpcache.Closing)
+	require.True(t, ok, "the legacy wrapper forwards Close")
+	assert.ErrorIs(t, closing.Close(), closeErr)
+	assert.Equal(t, 1, firstClosed)
+	assert.Equal(t, 1, secondClosed, "the second level is closed although the first one failed")
+}
+
+// statusBackend reports a fixed health status
+type statusBackend struct {
+	httpcache.ContextBackend
+	alive bool
+	notes string
+}
+
+func (b statusBackend) Status() (bool, string) {
+	return b.alive, b.notes
+}
+
+func TestTwoLevelBackend_Status(t *testing.T) {
+	t.Parallel()
+
+	newBackend := func(t *testing.T, first, second httpcache.ContextBackend) healthcheck.Status {
+		t.Helper()
+
+		backend, err := new(httpcache.TwoLevelBackendFactory).Inject(flamingo.NullLogger{}).SetConfig(httpcache.TwoLevelBackendConfig{
+			FirstLevel:  first,
+			SecondLevel: second,
+		}).Build()
+		require.NoError(t, err)
+
+		status, ok := backend.(healthcheck.Status)
+		require.True(t, ok)
+
+		return status
+	}
+
+	t.Run("notes of alive levels are included", func(t *testing.T) {
+		t.Parallel()
+
+		alive, notes := newBackend(t, createInMemoryBackend(), statusBackend{ContextBackend: createInMemoryBackend(), alive: true, notes: "master mymaster at 10.0.0.1:6379"}).Status()
+		assert.True(t, alive)
+		assert.Equal(t, "second backend: master mymaster at 10.0.0.1:6379", notes)
+	})
+
+	t.Run("a failing level is reported together with the notes of the other level", func(t *testing.T) {
+		t.Parallel()
+
+		alive, notes := newBackend(t,
+			statusBackend{ContextBackend: createInMemoryBackend(), alive: false, notes: "connection refused"},
+			statusBackend{ContextBackend: createInMemoryBackend(), alive: true, notes: "master mymaster at 10.0.0.1:6379"},
+		).Status()
+		assert.False(t, alive)
+		assert.Equal(t, "first backend: connection refused; second backend: master mymaster at 10.0.0.1:6379", notes)
+	})
+}
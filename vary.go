@@ -0,0 +1,152 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"flamingo.me/flamingo/v3/framework/flamingo"
+)
+
+// varyHeaderNames returns the canonical, sorted request header names of the Vary header
+func varyHeaderNames(header http.Header) []string {
+	var names []string
+
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
+
+// variantKey of the primary key for the values of the selecting request headers
+func variantKey(key string, names []string, requestHeader http.Header) string {
+	var variant strings.Builder
+
+	variant.WriteString(key + "|vary")
+
+	for _, name := range names {
+		variant.WriteString("|" + name + "=" + strings.Join(requestHeader.Values(name), ","))
+	}
+
+	return variant.String()
+}
+
+// isVariantIndex reports whether the entry is the index of the variants stored for its key
+func isVariantIndex(entry Entry) bool {
+	return len(entry.Meta.Variants) > 0
+}
+
+// store the loaded entry, entries with a Vary header are stored as variant next to an updated variant index at the key.
+// Returns the key the entry is stored at.
+func (f *Frontend) store(ctx context.Context, key string, requestHeader http.Header, entry Entry, notModified bool) (string, error) {
+	names := varyHeaderNames(entry.Header)
+	if len(names) == 0 {
+		return key, f.set(ctx, key, entry, notModified)
+	}
+
+	if slices.Contains(names, "*") {
+		// "Vary: *" never matches another request
+		return "", nil
+	}
+
+	storedKey := variantKey(key, names, requestHeader)
+
+	err := f.set(ctx, storedKey, entry, notModified)
+	if err != nil {
+		return storedKey, err
+	}
+
+	return storedKey, f.updateVariantIndex(ctx, key, names, storedKey, entry.Meta.KeepUntil())
+}
+
+// updateVariantIndex adds the variant key to the index, the index is kept as long as its longest living variant.
+// Backends implementing ContextVariantIndexing keep the variant keys themselves, so concurrent updates don't drop
+// each other's variants. Otherwise, the variant keys are kept in the index entry, which is not updated atomically.
+func (f *Frontend) updateVariantIndex(ctx context.Context, key string, names []string, storedKey string, keepUntil time.Time) error {
+	index := Entry{
+		Meta:   Meta{Variants: []string{storedKey}},
+		Header: map[string][]string{"Vary": {strings.Join(names, ", ")}},
+	}
+
+	indexed := false
+
+	if indexing, ok := f.backend.(ContextVariantIndexing); ok {
+		err := indexing.AddVariant(ctx, key, storedKey, keepUntil)
+		if err != nil && !errors.Is(err, ErrVariantIndexNotSupported) {
+			return err //nolint:wrapcheck // the error is logged by the caller
+		}
+
+		indexed = err == nil
+	}
+
+	previous, found, err := f.backend.Get(ctx, key)
+	if err != nil {
+		f.logger.WithContext(ctx).WithField(flamingo.LogKeyCategory, "httpcache").
+			Warn("Failed to get variant index, variants stored before can't be purged: ", key)
+	}
+
+	if found && isVariantIndex(previous) {
+		if !indexed {
+			// variants of other Vary headers are kept in the index, so they are purged with the key
+			index.Meta.Variants = append(slices.Clone(previous.Meta.Variants), storedKey)
+			slices.Sort(index.Meta.Variants)
+			index.Meta.Variants = slices.Compact(index.Meta.Variants)
+		}
+
+		if previous.Meta.GraceTime.After(keepUntil) {
+			keepUntil = previous.Meta.GraceTime
+		}
+	}
+
+	index.Meta.LifeTime = keepUntil
+	index.Meta.GraceTime = keepUntil
+
+	return f.backend.Set(ctx, key, index) //nolint:wrapcheck // the error is logged by the caller
+}
+
+// purgeVariants of the key, kept by the backend or in the variant index
+func (f *Frontend) purgeVariants(ctx context.Context, key string) error {
+	var (
+		errs     []error
+		variants []string
+	)
+
+	if indexing, ok := f.backend.(ContextVariantIndexing); ok {
+		removed, err := indexing.RemoveVariants(ctx, key)
+		if err != nil && !errors.Is(err, ErrVariantIndexNotSupported) {
+			errs = append(errs, err)
+		}
+
+		variants = removed
+	}
+
+	// the index entry lists the variants if the backend doesn't keep them, or stored before it did
+	index, found, err := f.backend.Get(ctx, key)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if found && isVariantIndex(index) {
+		variants = append(variants, index.Meta.Variants...)
+	}
+
+	slices.Sort(variants)
+
+	for _, variant := range slices.Compact(variants) {
+		if err := f.backend.Purge(ctx, variant); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}